@@ -0,0 +1,80 @@
+package duration
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type Duration time.Duration
+
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func parse(v interface{}) (Duration, error) {
+	switch v := v.(type) {
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration. values: duration(%s)", v)
+		}
+		return Duration(parsed), nil
+	case float64:
+		return Duration(int64(v)), nil
+	case int:
+		return Duration(int64(v)), nil
+	case int64:
+		return Duration(v), nil
+	case uint64:
+		return Duration(int64(v)), nil
+	case nil:
+		return 0, nil
+	}
+
+	return 0, fmt.Errorf("duration must be a string like \"5s\" or nanoseconds. values: type(%T)", v)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := parse(v)
+	if err != nil {
+		return err
+	}
+
+	*d = parsed
+	return nil
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v interface{}
+	err := unmarshal(&v)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := parse(v)
+	if err != nil {
+		return err
+	}
+
+	*d = parsed
+	return nil
+}
@@ -0,0 +1,124 @@
+package influx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+)
+
+const (
+	bucketPageSize = 100
+)
+
+var (
+	ErrBucketNotFound = errors.New("bucket not found")
+)
+
+func retentionRules(retention time.Duration) domain.RetentionRules {
+	expire := domain.RetentionRuleTypeExpire
+	return domain.RetentionRules{{
+		Type:         &expire,
+		EverySeconds: int64(retention / time.Second),
+	}}
+}
+
+func bucketRetention(b *domain.Bucket) time.Duration {
+	for _, r := range b.RetentionRules {
+		if r.Type == nil || *r.Type == domain.RetentionRuleTypeExpire {
+			return time.Duration(r.EverySeconds) * time.Second
+		}
+	}
+
+	return 0
+}
+
+func (h *Helper) org(ctx context.Context) (*domain.Organization, error) {
+	if h.Org == "" {
+		return nil, fmt.Errorf("org is not configured")
+	}
+
+	return h.ConnectClient.OrganizationsAPI().FindOrganizationByName(ctx, h.Org)
+}
+
+func (h *Helper) FindBucket(ctx context.Context, name string) (*domain.Bucket, error) {
+	for offset := 0; ; offset += bucketPageSize {
+		buckets, err := h.ConnectClient.BucketsAPI().FindBucketsByOrgName(
+			ctx,
+			h.Org,
+			api.PagingWithLimit(bucketPageSize),
+			api.PagingWithOffset(offset),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if buckets == nil {
+			break
+		}
+
+		for i := range *buckets {
+			if (*buckets)[i].Name == name {
+				return &(*buckets)[i], nil
+			}
+		}
+
+		if len(*buckets) < bucketPageSize {
+			break
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrBucketNotFound, name)
+}
+
+func (h *Helper) CreateBucket(ctx context.Context, name string, retention time.Duration) (*domain.Bucket, error) {
+	org, err := h.org(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.ConnectClient.BucketsAPI().CreateBucketWithName(ctx, org, name, retentionRules(retention)...)
+}
+
+func (h *Helper) SetBucketRetention(ctx context.Context, name string, retention time.Duration) error {
+	b, err := h.FindBucket(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	b.RetentionRules = retentionRules(retention)
+	_, err = h.ConnectClient.BucketsAPI().UpdateBucket(ctx, b)
+	return err
+}
+
+func (h *Helper) DeleteBucket(ctx context.Context, name string) error {
+	b, err := h.FindBucket(ctx, name)
+	if errors.Is(err, ErrBucketNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return h.ConnectClient.BucketsAPI().DeleteBucket(ctx, b)
+}
+
+func (h *Helper) EnsureBucket(ctx context.Context, name string, retention time.Duration) (*domain.Bucket, error) {
+	b, err := h.FindBucket(ctx, name)
+	if errors.Is(err, ErrBucketNotFound) {
+		return h.CreateBucket(ctx, name, retention)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if bucketRetention(b) == retention {
+		return b, nil
+	}
+
+	b.RetentionRules = retentionRules(retention)
+	return h.ConnectClient.BucketsAPI().UpdateBucket(ctx, b)
+}
@@ -0,0 +1,436 @@
+package influx
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	paramNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	durationUnits    = []struct {
+		unit string
+		d    time.Duration
+	}{
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+		{"ms", time.Millisecond},
+		{"us", time.Microsecond},
+		{"ns", time.Nanosecond},
+	}
+)
+
+type Param struct {
+	Name  string
+	Value interface{}
+}
+
+type Regex string
+
+type Predicate struct {
+	expr   string
+	params map[string]interface{}
+	err    error
+}
+
+type Flux struct {
+	steps  []string
+	params map[string]interface{}
+	err    error
+}
+
+func EscapeString(s string) string {
+	b := strings.Builder{}
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '$':
+			if i+1 < len(s) && s[i+1] == '{' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+func FormatDuration(d time.Duration) string {
+	if d == 0 {
+		return "0s"
+	}
+
+	b := strings.Builder{}
+	if d < 0 {
+		b.WriteByte('-')
+		if d == math.MinInt64 {
+			return "-2562047h47m16s854ms775us808ns"
+		}
+		d = -d
+	}
+
+	for _, u := range durationUnits {
+		if d >= u.d {
+			b.WriteString(strconv.FormatInt(int64(d/u.d), 10))
+			b.WriteString(u.unit)
+			d %= u.d
+		}
+	}
+
+	return b.String()
+}
+
+func formatRegex(r Regex) (string, error) {
+	s := string(r)
+	b := strings.Builder{}
+	b.WriteByte('/')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			if i+1 == len(s) {
+				return "", fmt.Errorf("influx: regex %q ends with a lone backslash", s)
+			}
+			b.WriteByte(c)
+			i++
+			switch s[i] {
+			case '\n':
+				b.WriteByte('n')
+			case '\r':
+				b.WriteByte('r')
+			default:
+				b.WriteByte(s[i])
+			}
+		case '/':
+			b.WriteString(`\/`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('/')
+
+	return b.String(), nil
+}
+
+func Literal(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return EscapeString(v), nil
+	case Regex:
+		return formatRegex(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano), nil
+	case time.Duration:
+		return FormatDuration(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return "uint(v: " + strconv.FormatUint(uint64(v), 10) + ")", nil
+	case uint64:
+		return "uint(v: " + strconv.FormatUint(v, 10) + ")", nil
+	case float32:
+		return formatFloat(float64(v))
+	case float64:
+		return formatFloat(v)
+	case []string:
+		items := make([]string, len(v))
+		for i, s := range v {
+			items[i] = EscapeString(s)
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	}
+
+	return "", fmt.Errorf("influx: unsupported flux literal type %T", v)
+}
+
+func formatFloat(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("influx: float %v has no flux literal", f)
+	}
+
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+
+	return s, nil
+}
+
+func mergeParams(dst map[string]interface{}, src map[string]interface{}) (map[string]interface{}, error) {
+	for k, v := range src {
+		if dst == nil {
+			dst = map[string]interface{}{}
+		}
+
+		existing, ok := dst[k]
+		if ok && fmt.Sprint(existing) != fmt.Sprint(v) {
+			return dst, fmt.Errorf("influx: param %s is bound to conflicting values", k)
+		}
+		dst[k] = v
+	}
+
+	return dst, nil
+}
+
+func render(v interface{}) (string, map[string]interface{}, error) {
+	p, ok := v.(Param)
+	if !ok {
+		s, err := Literal(v)
+		return s, nil, err
+	}
+
+	if !paramNamePattern.MatchString(p.Name) {
+		return "", nil, fmt.Errorf("influx: invalid param name %q", p.Name)
+	}
+
+	return "params." + p.Name, map[string]interface{}{p.Name: p.Value}, nil
+}
+
+func column(name string) string {
+	return "r[" + EscapeString(name) + "]"
+}
+
+func compare(col, op string, value interface{}) Predicate {
+	s, params, err := render(value)
+	if err != nil {
+		return Predicate{err: err}
+	}
+
+	return Predicate{expr: column(col) + " " + op + " " + s, params: params}
+}
+
+func Eq(col string, value interface{}) Predicate {
+	return compare(col, "==", value)
+}
+
+func Ne(col string, value interface{}) Predicate {
+	return compare(col, "!=", value)
+}
+
+func Gt(col string, value interface{}) Predicate {
+	return compare(col, ">", value)
+}
+
+func Gte(col string, value interface{}) Predicate {
+	return compare(col, ">=", value)
+}
+
+func Lt(col string, value interface{}) Predicate {
+	return compare(col, "<", value)
+}
+
+func Lte(col string, value interface{}) Predicate {
+	return compare(col, "<=", value)
+}
+
+func Match(col string, pattern Regex) Predicate {
+	return compare(col, "=~", pattern)
+}
+
+func NotMatch(col string, pattern Regex) Predicate {
+	return compare(col, "!~", pattern)
+}
+
+func Measurement(name interface{}) Predicate {
+	return Eq(columnMeasurement, name)
+}
+
+func Field(name interface{}) Predicate {
+	return Eq(columnField, name)
+}
+
+func join(op string, preds []Predicate) Predicate {
+	if len(preds) == 1 {
+		return preds[0]
+	}
+
+	exprs := make([]string, 0, len(preds))
+	var params map[string]interface{}
+	for _, p := range preds {
+		if p.err != nil {
+			return p
+		}
+
+		var err error
+		params, err = mergeParams(params, p.params)
+		if err != nil {
+			return Predicate{err: err}
+		}
+		exprs = append(exprs, "("+p.expr+")")
+	}
+
+	return Predicate{expr: strings.Join(exprs, " "+op+" "), params: params}
+}
+
+func And(preds ...Predicate) Predicate {
+	return join("and", preds)
+}
+
+func Or(preds ...Predicate) Predicate {
+	return join("or", preds)
+}
+
+func Not(pred Predicate) Predicate {
+	if pred.err != nil {
+		return pred
+	}
+
+	return Predicate{expr: "not (" + pred.expr + ")", params: pred.params}
+}
+
+func (p Predicate) String() string {
+	return p.expr
+}
+
+func From(bucket interface{}) *Flux {
+	f := &Flux{}
+	s, params, err := render(bucket)
+	return f.add("from(bucket: "+s+")", params, err)
+}
+
+func (f *Flux) add(step string, params map[string]interface{}, err error) *Flux {
+	if f.err != nil {
+		return f
+	}
+
+	if err != nil {
+		f.err = err
+		return f
+	}
+
+	f.params, f.err = mergeParams(f.params, params)
+	f.steps = append(f.steps, step)
+	return f
+}
+
+func (f *Flux) Range(start interface{}, stop ...interface{}) *Flux {
+	s, params, err := render(start)
+	if err != nil {
+		return f.add("", nil, err)
+	}
+
+	step := "range(start: " + s
+	if len(stop) > 0 && stop[0] != nil {
+		e, stopParams, err := render(stop[0])
+		if err != nil {
+			return f.add("", nil, err)
+		}
+
+		params, err = mergeParams(params, stopParams)
+		if err != nil {
+			return f.add("", nil, err)
+		}
+		step += ", stop: " + e
+	}
+
+	return f.add(step+")", params, nil)
+}
+
+func (f *Flux) Filter(preds ...Predicate) *Flux {
+	if len(preds) == 0 {
+		return f
+	}
+
+	p := And(preds...)
+	return f.add("filter(fn: (r) => "+p.expr+")", p.params, p.err)
+}
+
+func (f *Flux) AggregateWindow(every time.Duration, fn string, createEmpty bool) *Flux {
+	if !paramNamePattern.MatchString(fn) {
+		return f.add("", nil, fmt.Errorf("influx: invalid aggregate function %q", fn))
+	}
+
+	return f.add(fmt.Sprintf(
+		"aggregateWindow(every: %s, fn: %s, createEmpty: %t)",
+		FormatDuration(every),
+		fn,
+		createEmpty,
+	), nil, nil)
+}
+
+func (f *Flux) Group(columns ...string) *Flux {
+	cols, _ := Literal(columns)
+	return f.add("group(columns: "+cols+")", nil, nil)
+}
+
+func (f *Flux) Pivot(rowKey []string, columnKey []string, valueColumn string) *Flux {
+	rows, _ := Literal(rowKey)
+	cols, _ := Literal(columnKey)
+	return f.add(fmt.Sprintf(
+		"pivot(rowKey: %s, columnKey: %s, valueColumn: %s)",
+		rows,
+		cols,
+		EscapeString(valueColumn),
+	), nil, nil)
+}
+
+func (f *Flux) PivotFields() *Flux {
+	return f.Pivot([]string{columnTime}, []string{columnField}, columnValue)
+}
+
+func (f *Flux) Sort(desc bool, columns ...string) *Flux {
+	cols, _ := Literal(columns)
+	return f.add(fmt.Sprintf("sort(columns: %s, desc: %t)", cols, desc), nil, nil)
+}
+
+func (f *Flux) Limit(n int) *Flux {
+	return f.add("limit(n: "+strconv.Itoa(n)+")", nil, nil)
+}
+
+func (f *Flux) To(bucket string) *Flux {
+	return f.add("to(bucket: "+EscapeString(bucket)+")", nil, nil)
+}
+
+func (f *Flux) Yield(name string) *Flux {
+	return f.add("yield(name: "+EscapeString(name)+")", nil, nil)
+}
+
+func (f *Flux) Build() (string, map[string]interface{}, error) {
+	if f.err != nil {
+		return "", nil, f.err
+	}
+
+	if len(f.steps) == 0 {
+		return "", nil, fmt.Errorf("influx: flux query is empty")
+	}
+
+	return strings.Join(f.steps, "\n  |> "), f.params, nil
+}
+
+func (f *Flux) String() string {
+	s, _, _ := f.Build()
+	return s
+}
+
+func (f *Flux) Params() map[string]interface{} {
+	return f.params
+}
+
+func (f *Flux) Err() error {
+	return f.err
+}
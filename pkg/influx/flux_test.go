@@ -0,0 +1,283 @@
+package influx
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEscapeString(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{in: "cpu", want: `"cpu"`},
+		{in: `say "hi"`, want: `"say \"hi\""`},
+		{in: `C:\temp`, want: `"C:\\temp"`},
+		{in: "a\nb\rc\td", want: `"a\nb\rc\td"`},
+		{in: "${secret}", want: `"\${secret}"`},
+		{in: "cost: $5", want: `"cost: $5"`},
+		{in: "", want: `""`},
+	}
+
+	for _, c := range cases {
+		got := EscapeString(c.in)
+		if got != c.want {
+			t.Errorf("EscapeString(%q) = %s, want %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	cases := []struct {
+		in   time.Duration
+		want string
+	}{
+		{in: 0, want: "0s"},
+		{in: 90 * time.Minute, want: "1h30m"},
+		{in: 1500 * time.Millisecond, want: "1s500ms"},
+		{in: -5 * time.Second, want: "-5s"},
+		{in: time.Microsecond + time.Nanosecond, want: "1us1ns"},
+		{in: math.MinInt64, want: "-2562047h47m16s854ms775us808ns"},
+	}
+
+	for _, c := range cases {
+		got := FormatDuration(c.in)
+		if got != c.want {
+			t.Errorf("FormatDuration(%d) = %s, want %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	cases := []struct {
+		name    string
+		in      interface{}
+		want    string
+		wantErr bool
+	}{
+		{name: "string", in: "a\"b", want: `"a\"b"`},
+		{name: "bool", in: true, want: "true"},
+		{name: "int", in: -3, want: "-3"},
+		{name: "int32", in: int32(7), want: "7"},
+		{name: "int64", in: int64(1) << 40, want: "1099511627776"},
+		{name: "uint", in: uint(10), want: "uint(v: 10)"},
+		{name: "uint64", in: uint64(math.MaxUint64), want: "uint(v: 18446744073709551615)"},
+		{name: "float", in: 2.5, want: "2.5"},
+		{name: "whole float", in: float64(3), want: "3.0"},
+		{name: "float32", in: float32(0.5), want: "0.5"},
+		{name: "nan", in: math.NaN(), wantErr: true},
+		{name: "inf", in: math.Inf(1), wantErr: true},
+		{name: "time", in: time.Date(2024, 1, 2, 3, 4, 5, 6, time.FixedZone("x", 3600)), want: "2024-01-02T02:04:05.000000006Z"},
+		{name: "duration", in: -time.Hour, want: "-1h"},
+		{name: "strings", in: []string{"a", "b\"c"}, want: `["a", "b\"c"]`},
+		{name: "empty strings", in: []string{}, want: "[]"},
+		{name: "unsupported", in: struct{}{}, wantErr: true},
+	}
+
+	for _, c := range cases {
+		got, err := Literal(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s", c.name, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err.Error())
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: Literal(%v) = %s, want %s", c.name, c.in, got, c.want)
+		}
+	}
+}
+
+func TestFormatRegex(t *testing.T) {
+	cases := []struct {
+		in      Regex
+		want    string
+		wantErr bool
+	}{
+		{in: "^cpu.*", want: `/^cpu.*/`},
+		{in: "a/b", want: `/a\/b/`},
+		{in: `a\/b`, want: `/a\/b/`},
+		{in: `\d+\.\d+`, want: `/\d+\.\d+/`},
+		{in: `a\\`, want: `/a\\/`},
+		{in: "line\nbreak\r", want: `/line\nbreak\r/`},
+		{in: `trailing\`, wantErr: true},
+		{in: `a\\\`, wantErr: true},
+	}
+
+	for _, c := range cases {
+		got, err := Literal(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("Literal(Regex(%q)): expected an error, got %s", c.in, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Literal(Regex(%q)): unexpected error: %s", c.in, err.Error())
+			continue
+		}
+		if got != c.want {
+			t.Errorf("Literal(Regex(%q)) = %s, want %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestPredicates(t *testing.T) {
+	cases := []struct {
+		name       string
+		pred       Predicate
+		want       string
+		wantParams map[string]interface{}
+	}{
+		{name: "eq", pred: Eq("host", "a"), want: `r["host"] == "a"`},
+		{name: "ne", pred: Ne("code", 500), want: `r["code"] != 500`},
+		{name: "gt", pred: Gt("_value", 1.5), want: `r["_value"] > 1.5`},
+		{name: "gte", pred: Gte("count", uint(2)), want: `r["count"] >= uint(v: 2)`},
+		{name: "lt", pred: Lt("_value", int64(-1)), want: `r["_value"] < -1`},
+		{name: "lte", pred: Lte("_value", 0.0), want: `r["_value"] <= 0.0`},
+		{name: "match", pred: Match("host", "^web/[0-9]+$"), want: `r["host"] =~ /^web\/[0-9]+$/`},
+		{name: "not match", pred: NotMatch("host", "db"), want: `r["host"] !~ /db/`},
+		{name: "measurement", pred: Measurement("cpu"), want: `r["_measurement"] == "cpu"`},
+		{name: "field", pred: Field("usage"), want: `r["_field"] == "usage"`},
+		{name: "quoted column", pred: Eq(`we"ird`, "x"), want: `r["we\"ird"] == "x"`},
+		{
+			name:       "param",
+			pred:       Eq("host", Param{Name: "host", Value: "a"}),
+			want:       `r["host"] == params.host`,
+			wantParams: map[string]interface{}{"host": "a"},
+		},
+		{
+			name: "and or not",
+			pred: And(Measurement("cpu"), Or(Eq("host", "a"), Not(Eq("host", "b")))),
+			want: `(r["_measurement"] == "cpu") and ((r["host"] == "a") or (not (r["host"] == "b")))`,
+		},
+	}
+
+	for _, c := range cases {
+		if c.pred.err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, c.pred.err.Error())
+			continue
+		}
+		if c.pred.String() != c.want {
+			t.Errorf("%s: got %s, want %s", c.name, c.pred.String(), c.want)
+		}
+		if !reflect.DeepEqual(c.pred.params, c.wantParams) {
+			t.Errorf("%s: got params %v, want %v", c.name, c.pred.params, c.wantParams)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name       string
+		flux       *Flux
+		want       string
+		wantParams map[string]interface{}
+		wantErr    bool
+	}{
+		{
+			name: "relative range with pivot",
+			flux: From("metrics").
+				Range(-time.Hour).
+				Filter(Measurement("cpu"), Field("usage")).
+				PivotFields().
+				Limit(10),
+			want: `from(bucket: "metrics")
+  |> range(start: -1h)
+  |> filter(fn: (r) => (r["_measurement"] == "cpu") and (r["_field"] == "usage"))
+  |> pivot(rowKey: ["_time"], columnKey: ["_field"], valueColumn: "_value")
+  |> limit(n: 10)`,
+		},
+		{
+			name: "absolute range with aggregation",
+			flux: From("metrics").
+				Range(start, start.Add(time.Hour)).
+				Filter(Eq("host", "a")).
+				AggregateWindow(5*time.Minute, "mean", false).
+				Group("host").
+				Sort(true, "_time").
+				Yield("mean"),
+			want: `from(bucket: "metrics")
+  |> range(start: 2024-05-01T00:00:00Z, stop: 2024-05-01T01:00:00Z)
+  |> filter(fn: (r) => r["host"] == "a")
+  |> aggregateWindow(every: 5m, fn: mean, createEmpty: false)
+  |> group(columns: ["host"])
+  |> sort(columns: ["_time"], desc: true)
+  |> yield(name: "mean")`,
+		},
+		{
+			name: "params",
+			flux: From(Param{Name: "bucket", Value: "metrics"}).
+				Range(Param{Name: "start", Value: "-1h"}).
+				Filter(Eq("host", Param{Name: "host", Value: "a"})).
+				To("rollup"),
+			want: `from(bucket: params.bucket)
+  |> range(start: params.start)
+  |> filter(fn: (r) => r["host"] == params.host)
+  |> to(bucket: "rollup")`,
+			wantParams: map[string]interface{}{"bucket": "metrics", "start": "-1h", "host": "a"},
+		},
+		{
+			name: "empty filter is skipped",
+			flux: From("metrics").Range(-time.Minute).Filter(),
+			want: `from(bucket: "metrics")
+  |> range(start: -1m)`,
+		},
+		{
+			name:    "conflicting params",
+			flux:    From(Param{Name: "p", Value: "a"}).Filter(Eq("host", Param{Name: "p", Value: "b"})),
+			wantErr: true,
+		},
+		{
+			name:    "invalid param name",
+			flux:    From(Param{Name: "bad-name", Value: "a"}),
+			wantErr: true,
+		},
+		{
+			name:    "invalid aggregate function",
+			flux:    From("metrics").AggregateWindow(time.Minute, "mean()", false),
+			wantErr: true,
+		},
+		{
+			name:    "invalid regex",
+			flux:    From("metrics").Filter(Match("host", `web\`)),
+			wantErr: true,
+		},
+		{
+			name:    "empty query",
+			flux:    &Flux{},
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		got, params, err := c.flux.Build()
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s", c.name, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err.Error())
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", c.name, got, c.want)
+		}
+		if !reflect.DeepEqual(params, c.wantParams) {
+			t.Errorf("%s: got params %v, want %v", c.name, params, c.wantParams)
+		}
+	}
+}
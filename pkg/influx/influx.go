@@ -2,35 +2,56 @@ package influx
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
 	"sync"
+	"time"
 
-	"github.com/bigstack-oss/bigstack-dependency-go/pkg/wait"
 	influxv2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+	log "go-micro.dev/v5/logger"
+)
+
+const (
+	defaultTimeout = 60
 )
 
 var (
 	helper *Helper
 	once   sync.Once
+
+	ErrHelperNotInitialized = errors.New("influx global helper is not initialized, call NewGlobalHelper first")
 )
 
 type ConnectClient interface {
 	QueryAPI(string) api.QueryAPI
+	WriteAPI(string, string) api.WriteAPI
+	WriteAPIBlocking(string, string) api.WriteAPIBlocking
+	BucketsAPI() api.BucketsAPI
+	TasksAPI() api.TasksAPI
+	OrganizationsAPI() api.OrganizationsAPI
 	Close()
 }
 
 type QueryApiClient interface {
 	Query(context.Context, string) (*api.QueryTableResult, error)
+	QueryWithParams(context.Context, string, interface{}) (*api.QueryTableResult, error)
+	QueryRaw(context.Context, string, *domain.Dialect) (string, error)
 }
 
 type Helper struct {
 	ConnectClient
 	QueryApiClient
+	WriteApiClient
 	Options
 }
 
 func initOptions(opts []Option) *Options {
-	options := &Options{Auth: Auth{}}
+	options := &Options{Auth: Auth{}, Timeout: defaultTimeout}
 	for _, o := range opts {
 		o(options)
 	}
@@ -42,12 +63,124 @@ func NewHelper(opts ...Option) (*Helper, error) {
 	initedOpts := initOptions(opts)
 
 	h := &Helper{Options: *initedOpts}
-	h.ConnectClient = influxv2.NewClient(h.Options.Url, h.Options.Auth.Token)
+	clientOpts, err := h.genClientOptions()
+	if err != nil {
+		log.Errorf("err of influx client options: %s", err.Error())
+		return nil, err
+	}
+
+	h.ConnectClient = influxv2.NewClientWithOptions(h.Options.Url, h.Options.Auth.Token, clientOpts)
 	h.QueryApiClient = h.ConnectClient.QueryAPI(h.Options.Org)
+	if h.Options.Bucket != "" {
+		h.WriteApiClient = newWriteClient(h.ConnectClient, h.Options.Org, h.Options.Bucket)
+	}
 
 	return h, nil
 }
 
+func (h *Helper) genClientOptions() (*influxv2.Options, error) {
+	opts := influxv2.DefaultOptions()
+	if h.Timeout > 0 {
+		opts.SetHTTPRequestTimeout(h.Timeout)
+	}
+	if h.Gzip {
+		opts.SetUseGZip(true)
+	}
+	if h.Precision > 0 {
+		opts.SetPrecision(h.Precision.Std())
+	}
+
+	if h.TlsInsecureSkipVerify || h.TlsCaFile != "" || h.TlsCertFile != "" {
+		tlsConf, err := h.genTlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConf)
+	}
+
+	if h.Writer.BatchSize > 0 {
+		opts.SetBatchSize(h.Writer.BatchSize)
+	}
+	if h.Writer.FlushInterval > 0 {
+		opts.SetFlushInterval(uint(h.Writer.FlushInterval.Std().Milliseconds()))
+	}
+	if h.Writer.RetryBufferLimit > 0 {
+		opts.SetRetryBufferLimit(h.Writer.RetryBufferLimit)
+	}
+	if h.Writer.MaxRetries > 0 {
+		opts.SetMaxRetries(h.Writer.MaxRetries)
+	}
+
+	return opts, nil
+}
+
+func (h *Helper) genTlsConfig() (*tls.Config, error) {
+	conf := &tls.Config{InsecureSkipVerify: h.TlsInsecureSkipVerify}
+
+	if h.TlsCaFile != "" {
+		ca, err := os.ReadFile(h.TlsCaFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no valid certificates found in ca file %s", h.TlsCaFile)
+		}
+		conf.RootCAs = pool
+	}
+
+	if h.TlsCertFile != "" {
+		keyFile := h.TlsKeyFile
+		if keyFile == "" {
+			keyFile = h.TlsCertFile
+		}
+
+		cert, err := tls.LoadX509KeyPair(h.TlsCertFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	return conf, nil
+}
+
+func (h *Helper) queryTimeout() time.Duration {
+	if h.Timeout == 0 {
+		return defaultTimeout * time.Second
+	}
+
+	return time.Duration(h.Timeout) * time.Second
+}
+
+func (h *Helper) Query(ctx context.Context, stmt string) (*api.QueryTableResult, context.CancelFunc, error) {
+	queryCtx, cancel := context.WithTimeout(ctx, h.queryTimeout())
+	result, err := h.QueryApiClient.Query(queryCtx, stmt)
+	if err != nil {
+		cancel()
+		return nil, cancel, err
+	}
+
+	return result, cancel, nil
+}
+
+func (h *Helper) QueryRaw(ctx context.Context, stmt string, dialect *domain.Dialect) (string, error) {
+	if dialect == nil {
+		dialect = api.DefaultDialect()
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, h.queryTimeout())
+	defer cancel()
+
+	return h.QueryApiClient.QueryRaw(queryCtx, stmt, dialect)
+}
+
+func (h *Helper) QueryCSV(ctx context.Context, stmt string) (string, error) {
+	header := true
+	return h.QueryRaw(ctx, stmt, &domain.Dialect{Header: &header})
+}
+
 func NewGlobalHelper(opts ...Option) error {
 	var err error
 	once.Do(func() {
@@ -68,11 +201,14 @@ func GetGlobalHelper() *Helper {
 }
 
 func GetQueryCursor(stmt string) (*api.QueryTableResult, context.CancelFunc, error) {
-	ctx, cancel := context.WithTimeout(wait.CtxSeconds(60))
-	c, err := helper.QueryApiClient.Query(ctx, stmt)
-	return c, cancel, err
+	if helper == nil {
+		return nil, func() {}, ErrHelperNotInitialized
+	}
+
+	return helper.Query(context.Background(), stmt)
 }
 
 func (h *Helper) Close() {
+	h.Flush()
 	h.ConnectClient.Close()
 }
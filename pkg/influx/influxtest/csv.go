@@ -0,0 +1,226 @@
+package influxtest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	columnTime        = "_time"
+	columnMeasurement = "_measurement"
+	columnField       = "_field"
+	columnValue       = "_value"
+)
+
+type table struct {
+	columns []string
+	types   []string
+	groups  []bool
+	rows    [][]string
+}
+
+type Dialect struct {
+	Header      *bool    `json:"header"`
+	Annotations []string `json:"annotations"`
+}
+
+func dataType(v interface{}) string {
+	switch v.(type) {
+	case float64:
+		return "double"
+	case int64:
+		return "long"
+	case uint64:
+		return "unsignedLong"
+	case bool:
+		return "boolean"
+	}
+
+	return "string"
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	}
+
+	return fmt.Sprint(v)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func seriesKey(p Point) string {
+	b := strings.Builder{}
+	b.WriteString(p.Measurement)
+	for _, k := range sortedKeys(p.Tags) {
+		b.WriteString("," + k + "=" + p.Tags[k])
+	}
+
+	return b.String()
+}
+
+func seriesColumns(p Point) ([]string, []string) {
+	tags := sortedKeys(p.Tags)
+	columns := append([]string{columnMeasurement}, tags...)
+	values := []string{p.Measurement}
+	for _, k := range tags {
+		values = append(values, p.Tags[k])
+	}
+
+	return columns, values
+}
+
+func newTable(columns, valueColumns, valueTypes []string) *table {
+	t := &table{}
+	t.columns = append(t.columns, "result", "table", columnTime)
+	t.types = append(t.types, "string", "long", "dateTime:RFC3339Nano")
+	t.groups = append(t.groups, false, false, false)
+
+	for _, c := range columns {
+		t.columns = append(t.columns, c)
+		t.types = append(t.types, "string")
+		t.groups = append(t.groups, true)
+	}
+
+	for i, c := range valueColumns {
+		t.columns = append(t.columns, c)
+		t.types = append(t.types, valueTypes[i])
+		t.groups = append(t.groups, false)
+	}
+
+	return t
+}
+
+func buildTables(points []Point, pivot bool) []*table {
+	sorted := append([]Point{}, points...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ki, kj := seriesKey(sorted[i]), seriesKey(sorted[j])
+		if ki != kj {
+			return ki < kj
+		}
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	keys := []string{}
+	tables := map[string]*table{}
+	add := func(key string, mk func() *table, row []string) {
+		t, ok := tables[key]
+		if !ok {
+			t = mk()
+			tables[key] = t
+			keys = append(keys, key)
+		}
+		t.rows = append(t.rows, row)
+	}
+
+	for _, p := range sorted {
+		columns, values := seriesColumns(p)
+		fields := sortedKeys(p.Fields)
+
+		if pivot {
+			types := make([]string, len(fields))
+			row := append([]string{p.Time.UTC().Format(time.RFC3339Nano)}, values...)
+			for i, f := range fields {
+				types[i] = dataType(p.Fields[f])
+				row = append(row, formatValue(p.Fields[f]))
+			}
+
+			key := seriesKey(p) + "|" + strings.Join(fields, ",") + "|" + strings.Join(types, ",")
+			add(key, func() *table { return newTable(columns, fields, types) }, row)
+			continue
+		}
+
+		for _, f := range fields {
+			typ := dataType(p.Fields[f])
+			row := append([]string{p.Time.UTC().Format(time.RFC3339Nano)}, values...)
+			row = append(row, f, formatValue(p.Fields[f]))
+
+			key := seriesKey(p) + "|" + f + "|" + typ
+			add(key, func() *table {
+				return newTable(append(columns[:len(columns):len(columns)], columnField), []string{columnValue}, []string{typ})
+			}, row)
+		}
+	}
+
+	out := make([]*table, len(keys))
+	for i, k := range keys {
+		out[i] = tables[k]
+	}
+
+	return out
+}
+
+func annotated(d *Dialect) map[string]bool {
+	if d == nil {
+		return map[string]bool{}
+	}
+
+	set := map[string]bool{}
+	for _, a := range d.Annotations {
+		set[a] = true
+	}
+
+	return set
+}
+
+func encode(points []Point, pivot bool, d *Dialect) string {
+	header := d == nil || d.Header == nil || *d.Header
+	annotations := annotated(d)
+
+	buf := bytes.Buffer{}
+	w := csv.NewWriter(&buf)
+	for i, t := range buildTables(points, pivot) {
+		if i > 0 && len(annotations) > 0 {
+			w.Flush()
+			buf.WriteString("\n")
+		}
+
+		if i == 0 || len(annotations) > 0 {
+			if annotations["datatype"] {
+				w.Write(append([]string{"#datatype"}, t.types...))
+			}
+			if annotations["group"] {
+				groups := make([]string, len(t.groups))
+				for j, g := range t.groups {
+					groups[j] = strconv.FormatBool(g)
+				}
+				w.Write(append([]string{"#group"}, groups...))
+			}
+			if annotations["default"] {
+				defaults := make([]string, len(t.columns))
+				defaults[0] = "_result"
+				w.Write(append([]string{"#default"}, defaults...))
+			}
+			if header {
+				w.Write(append([]string{""}, t.columns...))
+			}
+		}
+
+		for _, row := range t.rows {
+			w.Write(append([]string{"", "_result", strconv.Itoa(i)}, row...))
+		}
+	}
+	w.Flush()
+
+	return buf.String()
+}
+
+func EncodeCSV(pivot bool, points ...Point) string {
+	return encode(points, pivot, &Dialect{Annotations: []string{"datatype", "group", "default"}})
+}
@@ -0,0 +1,153 @@
+package influxtest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	precisions = map[string]time.Duration{
+		"":   time.Nanosecond,
+		"ns": time.Nanosecond,
+		"us": time.Microsecond,
+		"ms": time.Millisecond,
+		"s":  time.Second,
+	}
+)
+
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	Time        time.Time
+}
+
+func split(s string, sep byte, quoted bool) []string {
+	parts := []string{}
+	inQuote := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case quoted && c == '"':
+			inQuote = !inQuote
+		case c == sep && !inQuote:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+func unescape(s, chars string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(chars, s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+func parseFieldValue(s string) (interface{}, error) {
+	switch {
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		return unescape(s[1:len(s)-1], `"\`), nil
+	case strings.HasSuffix(s, "i"):
+		return strconv.ParseInt(s[:len(s)-1], 10, 64)
+	case strings.HasSuffix(s, "u"):
+		return strconv.ParseUint(s[:len(s)-1], 10, 64)
+	}
+
+	switch s {
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	}
+
+	return strconv.ParseFloat(s, 64)
+}
+
+func parseLine(line string, precision time.Duration, now time.Time) (Point, error) {
+	sections := split(line, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return Point{}, fmt.Errorf("unable to parse '%s': invalid line", line)
+	}
+
+	key := split(sections[0], ',', false)
+	p := Point{
+		Measurement: unescape(key[0], `, \`),
+		Tags:        map[string]string{},
+		Fields:      map[string]interface{}{},
+		Time:        now,
+	}
+	if p.Measurement == "" {
+		return Point{}, fmt.Errorf("unable to parse '%s': missing measurement", line)
+	}
+
+	for _, tag := range key[1:] {
+		kv := split(tag, '=', false)
+		if len(kv) != 2 || kv[0] == "" {
+			return Point{}, fmt.Errorf("unable to parse '%s': invalid tag %s", line, tag)
+		}
+		p.Tags[unescape(kv[0], `,= \`)] = unescape(kv[1], `,= \`)
+	}
+
+	for _, field := range split(sections[1], ',', true) {
+		kv := split(field, '=', true)
+		if len(kv) != 2 || kv[0] == "" {
+			return Point{}, fmt.Errorf("unable to parse '%s': invalid field %s", line, field)
+		}
+
+		v, err := parseFieldValue(kv[1])
+		if err != nil {
+			return Point{}, fmt.Errorf("unable to parse '%s': invalid field value %s", line, kv[1])
+		}
+		p.Fields[unescape(kv[0], `,= \`)] = v
+	}
+
+	if len(sections) == 3 {
+		ts, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return Point{}, fmt.Errorf("unable to parse '%s': invalid timestamp %s", line, sections[2])
+		}
+		p.Time = time.Unix(0, ts*int64(precision)).UTC()
+	}
+
+	return p, nil
+}
+
+func ParseLineProtocol(body, precision string) ([]Point, error) {
+	unit, ok := precisions[precision]
+	if !ok {
+		return nil, fmt.Errorf("invalid precision %s", precision)
+	}
+
+	now := time.Now().UTC()
+	points := []Point{}
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p, err := parseLine(line, unit, now)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+
+	return points, nil
+}
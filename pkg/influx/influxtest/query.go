@@ -0,0 +1,341 @@
+package influxtest
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	operand = `"(?:[^"\\]|\\.)*"|params\.[A-Za-z_][A-Za-z0-9_]*`
+)
+
+var (
+	fromPattern     = regexp.MustCompile(`from\(\s*bucket\s*:\s*(` + operand + `)\s*\)`)
+	rangePattern    = regexp.MustCompile(`range\(\s*start\s*:\s*([^,)]+?)\s*(?:,\s*stop\s*:\s*([^)]+?)\s*)?\)`)
+	filterPattern   = regexp.MustCompile(`filter\(\s*fn\s*:\s*\(\s*r\s*\)\s*=>`)
+	predPattern     = regexp.MustCompile(`^r(?:\[\s*("(?:[^"\\]|\\.)*")\s*\]|\.([A-Za-z_][A-Za-z0-9_]*))\s*==\s*(` + operand + `)$`)
+	durationPattern = regexp.MustCompile(`(\d+)(ns|us|µs|ms|s|m|h|d|w)`)
+	fluxUnits       = map[string]time.Duration{
+		"ns": time.Nanosecond,
+		"us": time.Microsecond,
+		"µs": time.Microsecond,
+		"ms": time.Millisecond,
+		"s":  time.Second,
+		"m":  time.Minute,
+		"h":  time.Hour,
+		"d":  24 * time.Hour,
+		"w":  7 * 24 * time.Hour,
+	}
+)
+
+type querySpec struct {
+	bucket string
+	preds  map[string][]string
+	start  *time.Time
+	stop   *time.Time
+	pivot  bool
+}
+
+func unquote(s string) (string, error) {
+	return strconv.Unquote(strings.ReplaceAll(s, `\${`, `${`))
+}
+
+func resolve(s string, params map[string]interface{}) (string, error) {
+	name, ok := strings.CutPrefix(s, "params.")
+	if !ok {
+		return unquote(s)
+	}
+
+	v, ok := params[name]
+	if !ok {
+		return "", fmt.Errorf("param %s is not bound", name)
+	}
+
+	return fmt.Sprint(v), nil
+}
+
+func parseDuration(s string) (time.Duration, bool) {
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	matches := durationPattern.FindAllStringSubmatch(s, -1)
+	if len(matches) == 0 {
+		return 0, false
+	}
+
+	var d time.Duration
+	consumed := 0
+	for _, m := range matches {
+		n, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		d += time.Duration(n) * fluxUnits[m[2]]
+		consumed += len(m[0])
+	}
+
+	if consumed != len(s) {
+		return 0, false
+	}
+
+	if neg {
+		return -d, true
+	}
+
+	return d, true
+}
+
+func parseBound(s string, params map[string]interface{}, now time.Time) *time.Time {
+	if s == "now()" {
+		return &now
+	}
+
+	if strings.HasPrefix(s, "params.") {
+		v, err := resolve(s, params)
+		if err != nil {
+			return nil
+		}
+		s = v
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err == nil {
+		return &t
+	}
+
+	d, ok := parseDuration(s)
+	if !ok {
+		return nil
+	}
+
+	t = now.Add(d)
+	return &t
+}
+
+func parseQuery(flux string, params map[string]interface{}, now time.Time) (querySpec, error) {
+	spec := querySpec{
+		preds: map[string][]string{},
+		pivot: strings.Contains(flux, "pivot("),
+	}
+
+	m := fromPattern.FindStringSubmatch(flux)
+	if m == nil {
+		return spec, fmt.Errorf("influxtest: query has no from(bucket: ...) source")
+	}
+
+	bucket, err := resolve(m[1], params)
+	if err != nil {
+		return spec, err
+	}
+	spec.bucket = bucket
+
+	m = rangePattern.FindStringSubmatch(flux)
+	if m != nil {
+		spec.start = parseBound(m[1], params, now)
+		if m[2] != "" {
+			spec.stop = parseBound(m[2], params, now)
+		}
+	}
+
+	for _, loc := range filterPattern.FindAllStringIndex(flux, -1) {
+		body, err := filterBody(flux[loc[1]:])
+		if err != nil {
+			return spec, err
+		}
+
+		err = spec.addPredicates(body, params)
+		if err != nil {
+			return spec, err
+		}
+	}
+
+	return spec, nil
+}
+
+func unsupportedFilter(expr string) error {
+	return fmt.Errorf("influxtest: unsupported filter expression %s, only == comparisons joined by and are supported", expr)
+}
+
+func scan(s string, fn func(i, depth int) bool) error {
+	depth := 0
+	inString := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inString && c == '\\':
+			i++
+			continue
+		case c == '"':
+			inString = !inString
+			continue
+		case inString:
+			continue
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		}
+
+		if fn(i, depth) {
+			return nil
+		}
+		if depth < 0 {
+			break
+		}
+	}
+
+	return fmt.Errorf("influxtest: unbalanced parentheses in %s", s)
+}
+
+func filterBody(s string) (string, error) {
+	end := -1
+	err := scan(s, func(i, depth int) bool {
+		if depth < 0 {
+			end = i
+		}
+		return end >= 0
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(s[:end]), nil
+}
+
+func splitAnd(expr string) ([]string, error) {
+	terms := []string{}
+	start := 0
+	err := scan(expr+")", func(i, depth int) bool {
+		if depth == 0 && strings.HasPrefix(expr[i:], " and ") {
+			terms = append(terms, strings.TrimSpace(expr[start:i]))
+			start = i + len(" and ")
+		}
+		return depth < 0
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return append(terms, strings.TrimSpace(expr[start:])), nil
+}
+
+func enclosed(expr string) bool {
+	if !strings.HasPrefix(expr, "(") {
+		return false
+	}
+
+	end := -1
+	scan(expr, func(i, depth int) bool {
+		if depth == 0 {
+			end = i
+		}
+		return end >= 0
+	})
+
+	return end == len(expr)-1
+}
+
+func (spec querySpec) addPredicates(expr string, params map[string]interface{}) error {
+	terms, err := splitAnd(expr)
+	if err != nil {
+		return err
+	}
+
+	for _, term := range terms {
+		if enclosed(term) {
+			err = spec.addPredicates(term[1:len(term)-1], params)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		m := predPattern.FindStringSubmatch(term)
+		if m == nil {
+			return unsupportedFilter(term)
+		}
+
+		column := m[2]
+		if m[1] != "" {
+			column, err = unquote(m[1])
+			if err != nil {
+				return err
+			}
+		}
+
+		value, err := resolve(m[3], params)
+		if err != nil {
+			return err
+		}
+		spec.preds[column] = append(spec.preds[column], value)
+	}
+
+	return nil
+}
+
+func matchAll(values []string, v string) bool {
+	for _, value := range values {
+		if value != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (spec querySpec) matchSeries(p Point) bool {
+	for column, values := range spec.preds {
+		switch column {
+		case columnField:
+			continue
+		case columnMeasurement:
+			if !matchAll(values, p.Measurement) {
+				return false
+			}
+		default:
+			v, ok := p.Tags[column]
+			if !ok || !matchAll(values, v) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (spec querySpec) inRange(t time.Time) bool {
+	if spec.start != nil && t.Before(*spec.start) {
+		return false
+	}
+
+	return spec.stop == nil || t.Before(*spec.stop)
+}
+
+func (spec querySpec) eval(points []Point) []Point {
+	fields, filterFields := spec.preds[columnField]
+
+	out := []Point{}
+	for _, p := range points {
+		if !spec.inRange(p.Time) || !spec.matchSeries(p) {
+			continue
+		}
+
+		p = clone(p)
+		if filterFields {
+			for f := range p.Fields {
+				if !matchAll(fields, f) {
+					delete(p.Fields, f)
+				}
+			}
+		}
+
+		if len(p.Fields) > 0 {
+			out = append(out, p)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,336 @@
+package influxtest
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/influx"
+)
+
+const (
+	PathQuery = "/api/v2/query"
+	PathWrite = "/api/v2/write"
+
+	defaultOrg = "influxtest"
+)
+
+var (
+	errorCodes = map[int]string{
+		http.StatusBadRequest:            "invalid",
+		http.StatusUnauthorized:          "unauthorized",
+		http.StatusForbidden:             "forbidden",
+		http.StatusNotFound:              "not found",
+		http.StatusMethodNotAllowed:      "method not allowed",
+		http.StatusRequestEntityTooLarge: "request too large",
+		http.StatusUnprocessableEntity:   "unprocessable entity",
+		http.StatusTooManyRequests:       "too many requests",
+		http.StatusServiceUnavailable:    "unavailable",
+	}
+)
+
+type Response struct {
+	Path    string
+	Match   string
+	CSV     string
+	Status  int
+	Message string
+	Delay   time.Duration
+	Times   int
+}
+
+type queryRequest struct {
+	Query   string                 `json:"query"`
+	Params  map[string]interface{} `json:"params"`
+	Dialect *Dialect               `json:"dialect"`
+}
+
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	buckets   map[string][]Point
+	responses []*Response
+	queries   []string
+}
+
+func New() *Server {
+	s := &Server{buckets: map[string][]Point{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func NewHelper(opts ...influx.Option) (*influx.Helper, *Server, error) {
+	s := New()
+	opts = append([]influx.Option{influx.Org(defaultOrg)}, opts...)
+	opts = append(opts, influx.Url(s.URL))
+
+	h, err := influx.NewHelper(opts...)
+	if err != nil {
+		s.Close()
+		return nil, nil, err
+	}
+
+	return h, s, nil
+}
+
+func clone(p Point) Point {
+	c := Point{
+		Measurement: p.Measurement,
+		Tags:        make(map[string]string, len(p.Tags)),
+		Fields:      make(map[string]interface{}, len(p.Fields)),
+		Time:        p.Time,
+	}
+	for k, v := range p.Tags {
+		c.Tags[k] = v
+	}
+	for k, v := range p.Fields {
+		c.Fields[k] = v
+	}
+
+	return c
+}
+
+func (s *Server) Script(responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range responses {
+		r := responses[i]
+		s.responses = append(s.responses, &r)
+	}
+}
+
+func (s *Server) ResetScript() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses = nil
+}
+
+func (s *Server) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buckets = map[string][]Point{}
+	s.queries = nil
+}
+
+func (s *Server) Seed(bucket string, points ...Point) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store(bucket, points)
+}
+
+func (s *Server) Points(bucket string) []Point {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	points := []Point{}
+	for _, p := range s.buckets[bucket] {
+		points = append(points, clone(p))
+	}
+
+	return points
+}
+
+func (s *Server) Queries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.queries...)
+}
+
+func (s *Server) store(bucket string, points []Point) {
+	stored := s.buckets[bucket]
+	for _, p := range points {
+		p = clone(p)
+		if p.Tags == nil {
+			p.Tags = map[string]string{}
+		}
+		p.Time = p.Time.UTC()
+
+		merged := false
+		for i := range stored {
+			if stored[i].Time.Equal(p.Time) && seriesKey(stored[i]) == seriesKey(p) {
+				for k, v := range p.Fields {
+					stored[i].Fields[k] = v
+				}
+				merged = true
+				break
+			}
+		}
+
+		if !merged {
+			stored = append(stored, p)
+		}
+	}
+	s.buckets[bucket] = stored
+}
+
+func (s *Server) respond(ctx context.Context, path, subject string) (*Response, error) {
+	s.mu.Lock()
+	var hit *Response
+	for i, r := range s.responses {
+		if (r.Path != "" && r.Path != path) || !strings.Contains(subject, r.Match) {
+			continue
+		}
+
+		c := *r
+		hit = &c
+		if r.Times > 0 {
+			r.Times--
+			if r.Times == 0 {
+				s.responses = append(s.responses[:i], s.responses[i+1:]...)
+			}
+		}
+		break
+	}
+	s.mu.Unlock()
+
+	if hit == nil || hit.Delay <= 0 {
+		return hit, nil
+	}
+
+	t := time.NewTimer(hit.Delay)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-t.C:
+	}
+
+	return hit, nil
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	code, ok := errorCodes[status]
+	if !ok {
+		code = "internal error"
+	}
+
+	message := fmt.Sprintf(format, args...)
+	if message == "" {
+		message = http.StatusText(status)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"code": code, "message": message})
+}
+
+func readBody(r *http.Request) (string, error) {
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return "", err
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	b, err := io.ReadAll(body)
+	return string(b), err
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != PathQuery && r.URL.Path != PathWrite {
+		writeError(w, http.StatusNotFound, "path %s is not supported by influxtest", r.URL.Path)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method %s is not allowed on %s", r.Method, r.URL.Path)
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "unable to read request body: %s", err)
+		return
+	}
+
+	if r.URL.Path == PathWrite {
+		s.write(w, r, body)
+		return
+	}
+
+	s.query(w, r, body)
+}
+
+func (s *Server) write(w http.ResponseWriter, r *http.Request, body string) {
+	bucket := r.URL.Query().Get("bucket")
+	if bucket == "" {
+		writeError(w, http.StatusBadRequest, "bucket is required")
+		return
+	}
+
+	resp, err := s.respond(r.Context(), PathWrite, body)
+	if err != nil {
+		return
+	}
+	if resp != nil && resp.Status >= http.StatusMultipleChoices {
+		writeError(w, resp.Status, "%s", resp.Message)
+		return
+	}
+
+	points, err := ParseLineProtocol(body, r.URL.Query().Get("precision"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err)
+		return
+	}
+
+	s.mu.Lock()
+	s.store(bucket, points)
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) query(w http.ResponseWriter, r *http.Request, body string) {
+	req := queryRequest{}
+	err := json.Unmarshal([]byte(body), &req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "unable to decode query request: %s", err)
+		return
+	}
+
+	s.mu.Lock()
+	s.queries = append(s.queries, req.Query)
+	s.mu.Unlock()
+
+	resp, err := s.respond(r.Context(), PathQuery, req.Query)
+	if err != nil {
+		return
+	}
+	if resp != nil && resp.Status >= http.StatusMultipleChoices {
+		writeError(w, resp.Status, "%s", resp.Message)
+		return
+	}
+
+	csv := ""
+	if resp != nil && resp.CSV != "" {
+		csv = resp.CSV
+	} else {
+		spec, err := parseQuery(req.Query, req.Params, time.Now().UTC())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%s", err)
+			return
+		}
+
+		s.mu.Lock()
+		points := spec.eval(s.buckets[spec.bucket])
+		s.mu.Unlock()
+		csv = encode(points, spec.pivot, req.Dialect)
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, csv)
+}
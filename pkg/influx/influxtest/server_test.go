@@ -0,0 +1,241 @@
+package influxtest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/influx"
+)
+
+type cpu struct {
+	Measurement string    `influx:"measurement"`
+	Host        string    `influx:"host,tag"`
+	Usage       float64   `influx:"usage"`
+	Count       int64     `influx:"count"`
+	Time        time.Time `influx:"time"`
+}
+
+func newHelper(t *testing.T) (*influx.Helper, *Server) {
+	h, s, err := NewHelper(influx.Bucket("metrics"))
+	if err != nil {
+		t.Fatalf("failed to create helper: %s", err.Error())
+	}
+
+	t.Cleanup(func() {
+		h.Close()
+		s.Close()
+	})
+
+	return h, s
+}
+
+func seedCPU(t *testing.T, h *influx.Helper, start time.Time) {
+	err := h.Write(
+		context.Background(),
+		cpu{Measurement: "cpu", Host: "a", Usage: 1.5, Count: 1, Time: start},
+		cpu{Measurement: "cpu", Host: "b", Usage: 2.5, Count: 2, Time: start},
+		cpu{Measurement: "cpu", Host: "a", Usage: 3.5, Count: 3, Time: start.Add(time.Minute)},
+	)
+	if err != nil {
+		t.Fatalf("failed to write points: %s", err.Error())
+	}
+}
+
+func TestWriteQueryRoundTrip(t *testing.T) {
+	h, s := newHelper(t)
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	seedCPU(t, h, start)
+
+	if n := len(s.Points("metrics")); n != 3 {
+		t.Fatalf("expected 3 stored points, got %d", n)
+	}
+
+	cases := []struct {
+		name string
+		flux *influx.Flux
+	}{
+		{
+			name: "pivoted",
+			flux: influx.From("metrics").
+				Range(-2*time.Hour).
+				Filter(influx.Measurement("cpu"), influx.Eq("host", "a")).
+				PivotFields(),
+		},
+		{
+			name: "unpivoted",
+			flux: influx.From("metrics").
+				Range(-2*time.Hour).
+				Filter(influx.Measurement("cpu"), influx.Eq("host", "a")),
+		},
+		{
+			name: "params",
+			flux: influx.From(influx.Param{Name: "bucket", Value: "metrics"}).
+				Range(-2*time.Hour).
+				Filter(influx.Measurement("cpu"), influx.Eq("host", influx.Param{Name: "host", Value: "a"})),
+		},
+	}
+
+	for _, c := range cases {
+		rows, err := influx.QueryFlux[cpu](context.Background(), h, c.flux)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err.Error())
+			continue
+		}
+
+		if len(rows) != 2 {
+			t.Errorf("%s: expected 2 rows, got %d", c.name, len(rows))
+			continue
+		}
+
+		want := []cpu{
+			{Measurement: "cpu", Host: "a", Usage: 1.5, Count: 1, Time: start},
+			{Measurement: "cpu", Host: "a", Usage: 3.5, Count: 3, Time: start.Add(time.Minute)},
+		}
+		for i, row := range rows {
+			row.Time = row.Time.UTC()
+			if row != want[i] {
+				t.Errorf("%s: row %d is %+v, want %+v", c.name, i, row, want[i])
+			}
+		}
+	}
+}
+
+func TestQueryFilters(t *testing.T) {
+	h, _ := newHelper(t)
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	seedCPU(t, h, start)
+
+	cases := []struct {
+		name string
+		flux *influx.Flux
+		want int
+	}{
+		{
+			name: "field",
+			flux: influx.From("metrics").Range(-2 * time.Hour).Filter(influx.Field("usage")),
+			want: 3,
+		},
+		{
+			name: "nested and",
+			flux: influx.From("metrics").Range(-2 * time.Hour).Filter(
+				influx.And(influx.Measurement("cpu"), influx.And(influx.Eq("host", "b"), influx.Field("count"))),
+			),
+			want: 1,
+		},
+		{
+			name: "conflicting values",
+			flux: influx.From("metrics").Range(-2*time.Hour).Filter(influx.Eq("host", "a"), influx.Eq("host", "b")),
+			want: 0,
+		},
+		{
+			name: "range",
+			flux: influx.From("metrics").Range(start.Add(30*time.Second), start.Add(2*time.Minute)),
+			want: 2,
+		},
+	}
+
+	for _, c := range cases {
+		flux, _, err := c.flux.Build()
+		if err != nil {
+			t.Fatalf("%s: failed to build query: %s", c.name, err.Error())
+		}
+
+		result, cancel, err := h.Query(context.Background(), flux)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err.Error())
+			continue
+		}
+
+		n := 0
+		for result.Next() {
+			n++
+		}
+		cancel()
+
+		if result.Err() != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, result.Err().Error())
+		}
+		if n != c.want {
+			t.Errorf("%s: expected %d records, got %d", c.name, c.want, n)
+		}
+	}
+}
+
+func TestUnsupportedFilters(t *testing.T) {
+	h, _ := newHelper(t)
+
+	cases := []struct {
+		name string
+		pred influx.Predicate
+	}{
+		{name: "not equal", pred: influx.Ne("host", "a")},
+		{name: "greater than", pred: influx.Gt("_value", 1.0)},
+		{name: "regex", pred: influx.Match("host", "^a")},
+		{name: "not regex", pred: influx.NotMatch("host", "^a")},
+		{name: "or", pred: influx.Or(influx.Eq("host", "a"), influx.Eq("host", "b"))},
+		{name: "not", pred: influx.Not(influx.Eq("host", "a"))},
+		{name: "or nested in and", pred: influx.And(influx.Measurement("cpu"), influx.Or(influx.Eq("host", "a"), influx.Eq("host", "b")))},
+	}
+
+	for _, c := range cases {
+		f := influx.From("metrics").Range(-time.Hour).Filter(c.pred)
+		_, err := influx.QueryFlux[cpu](context.Background(), h, f)
+		if err == nil || !strings.Contains(err.Error(), "unsupported filter") {
+			t.Errorf("%s: expected an unsupported filter error, got %v", c.name, err)
+		}
+	}
+}
+
+func TestScriptedResponses(t *testing.T) {
+	h, s := newHelper(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s.Script(
+		Response{Path: PathWrite, Status: http.StatusServiceUnavailable, Message: "write unavailable", Times: 1},
+		Response{Path: PathQuery, Match: "scripted", CSV: EncodeCSV(true, Point{
+			Measurement: "cpu",
+			Tags:        map[string]string{"host": "z"},
+			Fields:      map[string]interface{}{"usage": 9.5, "count": int64(9)},
+			Time:        start,
+		})},
+		Response{Path: PathQuery, Match: "broken", Status: http.StatusBadRequest, Message: "bad flux"},
+	)
+
+	err := h.Write(context.Background(), cpu{Measurement: "cpu", Host: "a", Usage: 1, Time: start})
+	if err == nil || !strings.Contains(err.Error(), "write unavailable") {
+		t.Errorf("expected the scripted write error, got %v", err)
+	}
+
+	err = h.Write(context.Background(), cpu{Measurement: "cpu", Host: "a", Usage: 1, Time: start})
+	if err != nil {
+		t.Errorf("expected the write to succeed once the script is used up, got %s", err.Error())
+	}
+
+	rows, err := influx.Query[cpu](context.Background(), h, `from(bucket: "scripted") |> range(start: 0)`, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	want := cpu{Measurement: "cpu", Host: "z", Usage: 9.5, Count: 9, Time: start}
+	if len(rows) != 1 || rows[0] != want {
+		t.Errorf("expected the scripted row %+v, got %+v", want, rows)
+	}
+
+	_, err = influx.Query[cpu](context.Background(), h, `from(bucket: "broken") |> range(start: 0)`, nil)
+	if err == nil || !strings.Contains(err.Error(), "bad flux") {
+		t.Errorf("expected the scripted query error, got %v", err)
+	}
+
+	s.ResetScript()
+	_, err = influx.Query[cpu](context.Background(), h, `from(bucket: "broken") |> range(start: 0)`, nil)
+	if err != nil {
+		t.Errorf("expected no error after resetting the script, got %s", err.Error())
+	}
+
+	if n := len(s.Queries()); n != 3 {
+		t.Errorf("expected 3 recorded queries, got %d", n)
+	}
+}
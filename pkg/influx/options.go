@@ -1,5 +1,11 @@
 package influx
 
+import (
+	"time"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/duration"
+)
+
 var (
 	Opts *Options
 )
@@ -9,9 +15,23 @@ type Option func(*Options)
 type Options struct {
 	Url                   string `json:"url" yaml:"url"`
 	Org                   string `json:"org" yaml:"org"`
+	Bucket                string `json:"bucket" yaml:"bucket"`
 	Auth                  `json:"auth" yaml:"auth"`
-	TlsInsecureSkipVerify bool `json:"tlsInsecureSkipVerify" yaml:"tlsInsecureSkipVerify"`
-	Timeout               uint `json:"timeout" yaml:"timeout"`
+	TlsInsecureSkipVerify bool              `json:"tlsInsecureSkipVerify" yaml:"tlsInsecureSkipVerify"`
+	TlsCaFile             string            `json:"tlsCaFile" yaml:"tlsCaFile"`
+	TlsCertFile           string            `json:"tlsCertFile" yaml:"tlsCertFile"`
+	TlsKeyFile            string            `json:"tlsKeyFile" yaml:"tlsKeyFile"`
+	Timeout               uint              `json:"timeout" yaml:"timeout"`
+	Gzip                  bool              `json:"gzip" yaml:"gzip"`
+	Precision             duration.Duration `json:"precision" yaml:"precision"`
+	Writer                `json:"writer" yaml:"writer"`
+}
+
+type Writer struct {
+	BatchSize        uint              `json:"batchSize" yaml:"batchSize"`
+	FlushInterval    duration.Duration `json:"flushInterval" yaml:"flushInterval"`
+	RetryBufferLimit uint              `json:"retryBufferLimit" yaml:"retryBufferLimit"`
+	MaxRetries       uint              `json:"maxRetries" yaml:"maxRetries"`
 }
 
 type Auth struct {
@@ -30,6 +50,12 @@ func Org(org string) Option {
 	}
 }
 
+func Bucket(bucket string) Option {
+	return func(o *Options) {
+		o.Bucket = bucket
+	}
+}
+
 func AuthToken(token string) Option {
 	return func(o *Options) {
 		o.Token = token
@@ -41,3 +67,63 @@ func TlsInsecureSkipVerify(skip bool) Option {
 		o.TlsInsecureSkipVerify = skip
 	}
 }
+
+func TlsCaFile(file string) Option {
+	return func(o *Options) {
+		o.TlsCaFile = file
+	}
+}
+
+func TlsCertFile(file string) Option {
+	return func(o *Options) {
+		o.TlsCertFile = file
+	}
+}
+
+func TlsKeyFile(file string) Option {
+	return func(o *Options) {
+		o.TlsKeyFile = file
+	}
+}
+
+func Timeout(seconds uint) Option {
+	return func(o *Options) {
+		o.Timeout = seconds
+	}
+}
+
+func Gzip(enable bool) Option {
+	return func(o *Options) {
+		o.Gzip = enable
+	}
+}
+
+func Precision(precision time.Duration) Option {
+	return func(o *Options) {
+		o.Precision = duration.Duration(precision)
+	}
+}
+
+func WriteBatchSize(size uint) Option {
+	return func(o *Options) {
+		o.Writer.BatchSize = size
+	}
+}
+
+func WriteFlushInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.Writer.FlushInterval = duration.Duration(interval)
+	}
+}
+
+func WriteRetryBufferLimit(limit uint) Option {
+	return func(o *Options) {
+		o.Writer.RetryBufferLimit = limit
+	}
+}
+
+func WriteMaxRetries(retries uint) Option {
+	return func(o *Options) {
+		o.Writer.MaxRetries = retries
+	}
+}
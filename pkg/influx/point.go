@@ -0,0 +1,223 @@
+package influx
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+const (
+	structTag = "influx"
+
+	kindTag         = "tag"
+	kindField       = "field"
+	kindTime        = "time"
+	kindMeasurement = "measurement"
+)
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	fieldsCache sync.Map
+)
+
+type Measurer interface {
+	Measurement() string
+}
+
+type structField struct {
+	index []int
+	name  string
+	kind  string
+}
+
+func lowerFirst(s string) string {
+	r := []rune(s)
+	if len(r) == 0 {
+		return s
+	}
+
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
+
+func isKind(s string) bool {
+	switch s {
+	case kindTag, kindField, kindTime, kindMeasurement:
+		return true
+	}
+
+	return false
+}
+
+func parseTag(f reflect.StructField) (string, string, bool) {
+	tag, ok := f.Tag.Lookup(structTag)
+	if !ok || tag == "-" {
+		return "", "", false
+	}
+
+	parts := strings.Split(tag, ",")
+	name, kind := parts[0], kindField
+	if len(parts) == 1 && isKind(parts[0]) {
+		name, kind = "", parts[0]
+	}
+	if len(parts) > 1 {
+		kind = parts[1]
+	}
+
+	if name == "" {
+		switch kind {
+		case kindTime:
+			name = columnTime
+		case kindMeasurement:
+			name = columnMeasurement
+		default:
+			name = lowerFirst(f.Name)
+		}
+	}
+
+	return name, kind, isKind(kind)
+}
+
+func structFields(t reflect.Type) ([]structField, error) {
+	if cached, ok := fieldsCache.Load(t); ok {
+		return cached.([]structField), nil
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("influx: %s is not a struct", t)
+	}
+
+	fields := []structField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && f.Tag.Get(structTag) == "" {
+			nested, err := structFields(f.Type)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, n := range nested {
+				n.index = append([]int{i}, n.index...)
+				fields = append(fields, n)
+			}
+			continue
+		}
+
+		name, kind, ok := parseTag(f)
+		if !ok {
+			continue
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+
+		if kind == kindTime && ft != timeType {
+			return nil, fmt.Errorf("influx: time field %s of %s must be time.Time", f.Name, t)
+		}
+
+		fields = append(fields, structField{index: []int{i}, name: name, kind: kind})
+	}
+
+	fieldsCache.Store(t, fields)
+	return fields, nil
+}
+
+func fieldValue(v reflect.Value) (interface{}, bool) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+
+	if d, ok := v.Interface().(time.Duration); ok {
+		return int64(d), true
+	}
+
+	return v.Interface(), true
+}
+
+func NewPoint(v interface{}) (*write.Point, error) {
+	if p, ok := v.(*write.Point); ok {
+		return p, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("influx: point is nil")
+		}
+		rv = rv.Elem()
+	}
+
+	fields, err := structFields(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	measurement := lowerFirst(rv.Type().Name())
+	if m, ok := v.(Measurer); ok {
+		measurement = m.Measurement()
+	}
+
+	tags := map[string]string{}
+	values := map[string]interface{}{}
+	ts := time.Time{}
+	for _, f := range fields {
+		value, ok := fieldValue(rv.FieldByIndex(f.index))
+		if !ok {
+			continue
+		}
+
+		switch f.kind {
+		case kindMeasurement:
+			s := fmt.Sprint(value)
+			if s != "" {
+				measurement = s
+			}
+		case kindTag:
+			s := fmt.Sprint(value)
+			if s != "" {
+				tags[f.name] = s
+			}
+		case kindTime:
+			ts = value.(time.Time)
+		case kindField:
+			values[f.name] = value
+		}
+	}
+
+	if measurement == "" {
+		return nil, fmt.Errorf("influx: measurement of %s is empty", rv.Type())
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("influx: %s has no fields", rv.Type())
+	}
+
+	return write.NewPoint(measurement, tags, values, ts), nil
+}
+
+func NewPoints(records ...interface{}) ([]*write.Point, error) {
+	points := make([]*write.Point, 0, len(records))
+	for _, r := range records {
+		p, err := NewPoint(r)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+
+	return points, nil
+}
@@ -0,0 +1,288 @@
+package influx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/iterator"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/query"
+)
+
+const (
+	columnTime        = "_time"
+	columnMeasurement = "_measurement"
+	columnField       = "_field"
+	columnValue       = "_value"
+	columnStart       = "_start"
+	columnStop        = "_stop"
+	columnResult      = "result"
+	columnTable       = "table"
+)
+
+var (
+	ErrStopIteration = iterator.ErrStop
+	ErrNotPivoted    = errors.New("influx: records are not pivoted; add PivotFields() to the query to stream multi-field structs")
+)
+
+func isIntKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+func isUintKind(k reflect.Kind) bool {
+	return k >= reflect.Uint && k <= reflect.Uintptr
+}
+
+func isFloatKind(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+func convertible(src reflect.Value, t reflect.Type) bool {
+	dst := reflect.New(t).Elem()
+	switch k := src.Kind(); {
+	case isFloatKind(k) && (isIntKind(t.Kind()) || isUintKind(t.Kind())):
+		f := src.Float()
+		if f != math.Trunc(f) || math.IsInf(f, 0) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return false
+		}
+		if isIntKind(t.Kind()) {
+			return !dst.OverflowInt(int64(f))
+		}
+		return f >= 0 && !dst.OverflowUint(uint64(f))
+	case isIntKind(k) && isIntKind(t.Kind()):
+		return !dst.OverflowInt(src.Int())
+	case isIntKind(k) && isUintKind(t.Kind()):
+		return src.Int() >= 0 && !dst.OverflowUint(uint64(src.Int()))
+	case isUintKind(k) && isIntKind(t.Kind()):
+		return src.Uint() <= math.MaxInt64 && !dst.OverflowInt(int64(src.Uint()))
+	case isUintKind(k) && isUintKind(t.Kind()):
+		return !dst.OverflowUint(src.Uint())
+	}
+
+	return true
+}
+
+func setValue(dst reflect.Value, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+
+	if dst.Kind() == reflect.Pointer {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return setValue(dst.Elem(), v)
+	}
+
+	src := reflect.ValueOf(v)
+	switch {
+	case src.Type().AssignableTo(dst.Type()):
+		dst.Set(src)
+	case dst.Kind() == reflect.String:
+		dst.SetString(fmt.Sprint(v))
+	case src.Type().ConvertibleTo(dst.Type()) && src.Kind() != reflect.String && dst.Type() != timeType:
+		if !convertible(src, dst.Type()) {
+			return fmt.Errorf("influx: cannot convert %T(%v) to %s without losing precision", v, v, dst.Type())
+		}
+		dst.Set(src.Convert(dst.Type()))
+	default:
+		return fmt.Errorf("influx: cannot assign %T to %s", v, dst.Type())
+	}
+
+	return nil
+}
+
+func DecodeRecord(rec *query.FluxRecord, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("influx: decode target must be a non-nil pointer, got %T", v)
+	}
+	rv = rv.Elem()
+
+	fields, err := structFields(rv.Type())
+	if err != nil {
+		return err
+	}
+
+	values := rec.Values()
+	for _, f := range fields {
+		value, ok := values[f.name]
+		if !ok && f.kind == kindField && rec.Field() == f.name {
+			value, ok = rec.Value(), true
+		}
+		if !ok {
+			continue
+		}
+
+		err = setValue(rv.FieldByIndex(f.index), value)
+		if err != nil {
+			return fmt.Errorf("influx: column %s: %w", f.name, err)
+		}
+	}
+
+	return nil
+}
+
+func isPivoted(rec *query.FluxRecord) bool {
+	values := rec.Values()
+	_, hasField := values[columnField]
+	_, hasValue := values[columnValue]
+	return !hasField || !hasValue
+}
+
+func seriesKey(rec *query.FluxRecord) string {
+	keys := []string{}
+	for k, v := range rec.Values() {
+		switch k {
+		case columnField, columnValue, columnStart, columnStop, columnResult, columnTable:
+			continue
+		}
+		keys = append(keys, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(keys)
+
+	return strings.Join(keys, ",")
+}
+
+func fieldCount(t reflect.Type) (int, error) {
+	fields, err := structFields(t)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, f := range fields {
+		if f.kind == kindField {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (h *Helper) queryWithParams(ctx context.Context, flux string, params interface{}) (*api.QueryTableResult, error) {
+	if m, ok := params.(map[string]interface{}); params == nil || (ok && len(m) == 0) {
+		return h.QueryApiClient.Query(ctx, flux)
+	}
+
+	return h.QueryApiClient.QueryWithParams(ctx, flux, params)
+}
+
+func Query[T any](ctx context.Context, h *Helper, flux string, params interface{}) ([]T, error) {
+	result, err := h.queryWithParams(ctx, flux, params)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	items := []T{}
+	rows := map[string]int{}
+	for result.Next() {
+		rec := result.Record()
+		if isPivoted(rec) {
+			var item T
+			err = DecodeRecord(rec, &item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+
+		key := seriesKey(rec)
+		i, ok := rows[key]
+		if !ok {
+			var item T
+			i = len(items)
+			rows[key] = i
+			items = append(items, item)
+		}
+
+		err = DecodeRecord(rec, &items[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	return items, nil
+}
+
+func QueryFlux[T any](ctx context.Context, h *Helper, f *Flux) ([]T, error) {
+	flux, params, err := f.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	return Query[T](ctx, h, flux, params)
+}
+
+type Stream[T any] struct {
+	*iterator.Stream[T]
+}
+
+type resultSource[T any] struct {
+	result *api.QueryTableResult
+}
+
+func (r resultSource[T]) Next(context.Context) bool {
+	return r.result.Next()
+}
+
+func (r resultSource[T]) Decode() (T, error) {
+	var item T
+	rec := r.result.Record()
+	if !isPivoted(rec) {
+		n, err := fieldCount(reflect.TypeOf(item))
+		if err != nil {
+			return item, err
+		}
+		if n > 1 {
+			return item, ErrNotPivoted
+		}
+	}
+
+	err := DecodeRecord(rec, &item)
+	return item, err
+}
+
+func (r resultSource[T]) Err() error {
+	return r.result.Err()
+}
+
+func (r resultSource[T]) Close() {
+	r.result.Close()
+}
+
+func QueryStream[T any](ctx context.Context, h *Helper, flux string, params interface{}) (*Stream[T], error) {
+	s, err := iterator.Open(ctx, func(ctx context.Context) (iterator.Source[T], error) {
+		result, err := h.queryWithParams(ctx, flux, params)
+		if err != nil {
+			return nil, err
+		}
+
+		return resultSource[T]{result: result}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Stream[T]{Stream: s}, nil
+}
+
+func ForEach[T any](ctx context.Context, h *Helper, flux string, params interface{}, fn func(T) error) error {
+	s, err := QueryStream[T](ctx, h, flux, params)
+	if err != nil {
+		return err
+	}
+
+	return iterator.ForEach(s.Stream, fn)
+}
@@ -0,0 +1,245 @@
+package influx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/duration"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+)
+
+const (
+	defaultRollupFn = "mean"
+)
+
+var (
+	ErrTaskNotFound = errors.New("task not found")
+)
+
+type Rollup struct {
+	Bucket    string            `json:"bucket" yaml:"bucket"`
+	Every     duration.Duration `json:"every" yaml:"every"`
+	Offset    duration.Duration `json:"offset" yaml:"offset"`
+	Retention duration.Duration `json:"retention" yaml:"retention"`
+	Fn        string            `json:"fn" yaml:"fn"`
+}
+
+type DownsamplingSpec struct {
+	Name         string   `json:"name" yaml:"name"`
+	Source       string   `json:"source" yaml:"source"`
+	Measurements []string `json:"measurements" yaml:"measurements"`
+	Rollups      []Rollup `json:"rollups" yaml:"rollups"`
+}
+
+func taskFlux(name string, every, offset time.Duration, body string) string {
+	opts := []string{
+		"name: " + EscapeString(name),
+		"every: " + FormatDuration(every),
+	}
+	if offset > 0 {
+		opts = append(opts, "offset: "+FormatDuration(offset))
+	}
+
+	return "option task = {" + strings.Join(opts, ", ") + "}\n\n" + body
+}
+
+func (h *Helper) FindTask(ctx context.Context, name string) (*domain.Task, error) {
+	tasks, err := h.ConnectClient.TasksAPI().FindTasks(ctx, &api.TaskFilter{Name: name, OrgName: h.Org})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range tasks {
+		if tasks[i].Name == name {
+			return &tasks[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, name)
+}
+
+func (h *Helper) CreateTask(ctx context.Context, name, flux string, every time.Duration) (*domain.Task, error) {
+	org, err := h.org(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if org.Id == nil {
+		return nil, fmt.Errorf("org %s has no id", h.Org)
+	}
+
+	return h.ConnectClient.TasksAPI().CreateTaskByFlux(ctx, taskFlux(name, every, 0, flux), *org.Id)
+}
+
+func (h *Helper) UpdateTask(ctx context.Context, name, flux string, every time.Duration) (*domain.Task, error) {
+	t, err := h.FindTask(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Flux = taskFlux(name, every, 0, flux)
+	t.Every, t.Cron, t.Offset = nil, nil, nil
+	return h.ConnectClient.TasksAPI().UpdateTask(ctx, t)
+}
+
+func (h *Helper) setTaskStatus(ctx context.Context, name string, status domain.TaskStatusType) error {
+	t, err := h.FindTask(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if t.Status != nil && *t.Status == status {
+		return nil
+	}
+
+	t.Status = &status
+	t.Every, t.Cron, t.Offset = nil, nil, nil
+	_, err = h.ConnectClient.TasksAPI().UpdateTask(ctx, t)
+	return err
+}
+
+func (h *Helper) EnableTask(ctx context.Context, name string) error {
+	return h.setTaskStatus(ctx, name, domain.TaskStatusTypeActive)
+}
+
+func (h *Helper) DisableTask(ctx context.Context, name string) error {
+	return h.setTaskStatus(ctx, name, domain.TaskStatusTypeInactive)
+}
+
+func (h *Helper) DeleteTask(ctx context.Context, name string) error {
+	t, err := h.FindTask(ctx, name)
+	if errors.Is(err, ErrTaskNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return h.ConnectClient.TasksAPI().DeleteTask(ctx, t)
+}
+
+func (h *Helper) TaskRuns(ctx context.Context, name string, limit int) ([]domain.Run, error) {
+	t, err := h.FindTask(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.ConnectClient.TasksAPI().FindRuns(ctx, t, &api.RunFilter{Limit: limit})
+}
+
+func (spec DownsamplingSpec) taskName(r Rollup) string {
+	prefix := spec.Name
+	if prefix == "" {
+		prefix = "downsample"
+	}
+
+	return fmt.Sprintf("%s_%s_to_%s", prefix, spec.Source, r.Bucket)
+}
+
+func (spec DownsamplingSpec) flux(r Rollup) (string, error) {
+	fn := r.Fn
+	if fn == "" {
+		fn = defaultRollupFn
+	}
+
+	f := From(spec.Source).Range(-r.Every.Std())
+	if len(spec.Measurements) > 0 {
+		preds := make([]Predicate, len(spec.Measurements))
+		for i, m := range spec.Measurements {
+			preds[i] = Measurement(m)
+		}
+		f = f.Filter(Or(preds...))
+	}
+
+	query, _, err := f.AggregateWindow(r.Every.Std(), fn, false).To(r.Bucket).Build()
+	return query, err
+}
+
+func (spec DownsamplingSpec) validate() error {
+	if spec.Source == "" {
+		return fmt.Errorf("downsampling source bucket is empty")
+	}
+
+	for _, r := range spec.Rollups {
+		if r.Bucket == "" || r.Every <= 0 {
+			return fmt.Errorf(
+				"rollup of %s requires a bucket and a positive interval. values: bucket(%s); every(%s)",
+				spec.Source,
+				r.Bucket,
+				r.Every,
+			)
+		}
+
+		if r.Bucket == spec.Source {
+			return fmt.Errorf("rollup bucket %s must differ from its source", r.Bucket)
+		}
+	}
+
+	return nil
+}
+
+func (h *Helper) EnsureDownsampling(ctx context.Context, spec DownsamplingSpec) ([]*domain.Task, error) {
+	err := spec.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	org, err := h.org(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if org.Id == nil {
+		return nil, fmt.Errorf("org %s has no id", h.Org)
+	}
+
+	tasks := []*domain.Task{}
+	for _, r := range spec.Rollups {
+		_, err = h.EnsureBucket(ctx, r.Bucket, r.Retention.Std())
+		if err != nil {
+			return tasks, err
+		}
+
+		body, err := spec.flux(r)
+		if err != nil {
+			return tasks, err
+		}
+
+		name := spec.taskName(r)
+		flux := taskFlux(name, r.Every.Std(), r.Offset.Std(), body)
+
+		t, err := h.FindTask(ctx, name)
+		if errors.Is(err, ErrTaskNotFound) {
+			t, err = h.ConnectClient.TasksAPI().CreateTaskByFlux(ctx, flux, *org.Id)
+			if err != nil {
+				return tasks, err
+			}
+
+			tasks = append(tasks, t)
+			continue
+		}
+		if err != nil {
+			return tasks, err
+		}
+
+		active := domain.TaskStatusTypeActive
+		if t.Flux != flux || t.Status == nil || *t.Status != active {
+			t.Flux = flux
+			t.Status = &active
+			t.Every, t.Cron, t.Offset = nil, nil, nil
+
+			t, err = h.ConnectClient.TasksAPI().UpdateTask(ctx, t)
+			if err != nil {
+				return tasks, err
+			}
+		}
+
+		tasks = append(tasks, t)
+	}
+
+	return tasks, nil
+}
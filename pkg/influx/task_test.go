@@ -0,0 +1,54 @@
+package influx
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRollupDurations(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+	}{
+		{
+			name: "strings",
+			in:   `{"source": "raw", "rollups": [{"bucket": "hourly", "every": "1h", "offset": "5m", "retention": "720h"}]}`,
+		},
+		{
+			name: "nanoseconds",
+			in:   `{"source": "raw", "rollups": [{"bucket": "hourly", "every": 3600000000000, "offset": 300000000000, "retention": 2592000000000000}]}`,
+		},
+	}
+
+	for _, c := range cases {
+		spec := DownsamplingSpec{}
+		err := json.Unmarshal([]byte(c.in), &spec)
+		if err != nil {
+			t.Fatalf("%s: failed to unmarshal spec: %s", c.name, err.Error())
+		}
+
+		r := spec.Rollups[0]
+		if r.Every.Std() != time.Hour || r.Offset.Std() != 5*time.Minute || r.Retention.Std() != 720*time.Hour {
+			t.Errorf("%s: unexpected durations every(%s); offset(%s); retention(%s)", c.name, r.Every, r.Offset, r.Retention)
+		}
+
+		err = spec.validate()
+		if err != nil {
+			t.Fatalf("%s: spec is invalid: %s", c.name, err.Error())
+		}
+
+		body, err := spec.flux(r)
+		if err != nil {
+			t.Fatalf("%s: failed to build flux: %s", c.name, err.Error())
+		}
+
+		got := taskFlux(spec.taskName(r), r.Every.Std(), r.Offset.Std(), body)
+		for _, want := range []string{"every: 1h", "offset: 5m", "range(start: -1h)", "every: 1h, fn: mean"} {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: task flux is missing %q:\n%s", c.name, want, got)
+			}
+		}
+	}
+}
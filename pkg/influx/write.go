@@ -0,0 +1,100 @@
+package influx
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+type WriteApiClient interface {
+	WritePoint(context.Context, ...*write.Point) error
+	WritePointAsync(...*write.Point)
+	Errors() <-chan error
+	Flush()
+}
+
+type writeClient struct {
+	blocking api.WriteAPIBlocking
+	async    api.WriteAPI
+	errs     <-chan error
+}
+
+func newWriteClient(c ConnectClient, org, bucket string) *writeClient {
+	async := c.WriteAPI(org, bucket)
+	return &writeClient{
+		blocking: c.WriteAPIBlocking(org, bucket),
+		async:    async,
+		errs:     async.Errors(),
+	}
+}
+
+func (w *writeClient) WritePoint(ctx context.Context, points ...*write.Point) error {
+	return w.blocking.WritePoint(ctx, points...)
+}
+
+func (w *writeClient) WritePointAsync(points ...*write.Point) {
+	for _, p := range points {
+		w.async.WritePoint(p)
+	}
+}
+
+func (w *writeClient) Errors() <-chan error {
+	return w.errs
+}
+
+func (w *writeClient) Flush() {
+	w.async.Flush()
+}
+
+func (h *Helper) writer() (WriteApiClient, error) {
+	if h.WriteApiClient == nil {
+		return nil, fmt.Errorf("write client is not initialized: bucket is not configured")
+	}
+
+	return h.WriteApiClient, nil
+}
+
+func (h *Helper) Write(ctx context.Context, records ...interface{}) error {
+	w, err := h.writer()
+	if err != nil {
+		return err
+	}
+
+	points, err := NewPoints(records...)
+	if err != nil {
+		return err
+	}
+
+	return w.WritePoint(ctx, points...)
+}
+
+func (h *Helper) WriteAsync(records ...interface{}) error {
+	w, err := h.writer()
+	if err != nil {
+		return err
+	}
+
+	points, err := NewPoints(records...)
+	if err != nil {
+		return err
+	}
+
+	w.WritePointAsync(points...)
+	return nil
+}
+
+func (h *Helper) WriteErrors() <-chan error {
+	if h.WriteApiClient == nil {
+		return nil
+	}
+
+	return h.WriteApiClient.Errors()
+}
+
+func (h *Helper) Flush() {
+	if h.WriteApiClient != nil {
+		h.WriteApiClient.Flush()
+	}
+}
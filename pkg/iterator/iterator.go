@@ -0,0 +1,109 @@
+package iterator
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	ErrStop = errors.New("stop iteration")
+)
+
+type Source[T any] interface {
+	Next(ctx context.Context) bool
+	Decode() (T, error)
+	Err() error
+	Close()
+}
+
+// Stream feeds items from a Source to C until the source is drained or the
+// stream is closed. Close, or Err, must always be called: a caller that stops
+// reading C early leaves the producer blocked with the source open until then.
+// ForEach closes the stream itself.
+type Stream[T any] struct {
+	ch     chan T
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+	err    error
+}
+
+func Open[T any](ctx context.Context, open func(ctx context.Context) (Source[T], error)) (*Stream[T], error) {
+	iterCtx, cancel := context.WithCancel(ctx)
+	src, err := open(iterCtx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	s := &Stream[T]{
+		ch:     make(chan T),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go s.run(ctx, iterCtx, src)
+	return s, nil
+}
+
+func (s *Stream[T]) run(parent, ctx context.Context, src Source[T]) {
+	defer close(s.done)
+	defer close(s.ch)
+	defer src.Close()
+
+	for src.Next(ctx) {
+		item, err := src.Decode()
+		if err != nil {
+			s.err = err
+			return
+		}
+
+		select {
+		case s.ch <- item:
+		case <-ctx.Done():
+			s.err = parent.Err()
+			return
+		}
+	}
+
+	if parent.Err() != nil {
+		s.err = parent.Err()
+		return
+	}
+
+	err := src.Err()
+	if err != nil && ctx.Err() == nil {
+		s.err = err
+	}
+}
+
+func (s *Stream[T]) C() <-chan T {
+	return s.ch
+}
+
+func (s *Stream[T]) Err() error {
+	return s.Close()
+}
+
+func (s *Stream[T]) Close() error {
+	s.once.Do(s.cancel)
+	<-s.done
+	return s.err
+}
+
+func ForEach[T any](s *Stream[T], fn func(T) error) error {
+	defer s.Close()
+
+	for item := range s.C() {
+		err := fn(item)
+		if errors.Is(err, ErrStop) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.Err()
+}
@@ -0,0 +1,146 @@
+package mongo
+
+import (
+	"context"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Pipeline []bson.D
+
+func NewPipeline() Pipeline {
+	return Pipeline{}
+}
+
+func (p Pipeline) Stage(name string, value interface{}) Pipeline {
+	return append(p, bson.D{{Key: name, Value: value}})
+}
+
+func (p Pipeline) Match(filter interface{}) Pipeline {
+	return p.Stage("$match", filter)
+}
+
+func (p Pipeline) Group(id interface{}, fields bson.M) Pipeline {
+	group := bson.D{{Key: "_id", Value: id}}
+	for _, k := range sortedKeys(fields) {
+		group = append(group, bson.E{Key: k, Value: fields[k]})
+	}
+
+	return p.Stage("$group", group)
+}
+
+func (p Pipeline) Project(projection interface{}) Pipeline {
+	return p.Stage("$project", projection)
+}
+
+func (p Pipeline) Sort(sort bson.D) Pipeline {
+	return p.Stage("$sort", sort)
+}
+
+func (p Pipeline) Skip(n int64) Pipeline {
+	return p.Stage("$skip", n)
+}
+
+func (p Pipeline) Limit(n int64) Pipeline {
+	return p.Stage("$limit", n)
+}
+
+func (p Pipeline) Lookup(from, localField, foreignField, as string) Pipeline {
+	return p.Stage("$lookup", bson.D{
+		{Key: "from", Value: from},
+		{Key: "localField", Value: localField},
+		{Key: "foreignField", Value: foreignField},
+		{Key: "as", Value: as},
+	})
+}
+
+func (p Pipeline) Unwind(path string, preserveNullAndEmpty bool) Pipeline {
+	if !preserveNullAndEmpty {
+		return p.Stage("$unwind", path)
+	}
+
+	return p.Stage("$unwind", bson.D{
+		{Key: "path", Value: path},
+		{Key: "preserveNullAndEmptyArrays", Value: true},
+	})
+}
+
+func (p Pipeline) Facet(facets map[string]Pipeline) Pipeline {
+	names := []string{}
+	for name := range facets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	facet := bson.D{}
+	for _, name := range names {
+		facet = append(facet, bson.E{Key: name, Value: facets[name]})
+	}
+
+	return p.Stage("$facet", facet)
+}
+
+func sortedKeys(m bson.M) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// AggregateCursor returns the pipeline output as stored, secure fields stay
+// encrypted. Use Decrypt on each document or Aggregate to read them in plain.
+func (h *Helper) AggregateCursor(ctx context.Context, db, coll string, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+	c, err := h.NewCollCli(db, coll)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Aggregate(ctx, pipeline, opts...)
+}
+
+func (h *Helper) Aggregate(ctx context.Context, db, coll string, pipeline interface{}, results interface{}, opts ...*options.AggregateOptions) error {
+	ctx, cancel := h.withTimeout(ctx)
+	defer cancel()
+
+	cursor, err := h.AggregateCursor(ctx, db, coll, pipeline, opts...)
+	if err != nil {
+		return err
+	}
+
+	raws := []bson.Raw{}
+	err = cursor.All(ctx, &raws)
+	if err != nil {
+		return err
+	}
+
+	docs := make([]interface{}, len(raws))
+	for i, raw := range raws {
+		docs[i], err = h.Decrypt(db, coll, raw)
+		if err != nil {
+			return err
+		}
+	}
+
+	decrypted, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	return decrypted.All(ctx, results)
+}
+
+func Aggregate[T any](ctx context.Context, h *Helper, db, coll string, pipeline interface{}, opts ...*options.AggregateOptions) ([]T, error) {
+	results := []T{}
+	err := h.Aggregate(ctx, db, coll, pipeline, &results, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
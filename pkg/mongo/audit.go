@@ -0,0 +1,293 @@
+package mongo
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ctxKey int
+
+const (
+	actorKey ctxKey = iota
+	withDeletedKey
+)
+
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey).(string)
+	return actor
+}
+
+func WithDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withDeletedKey, true)
+}
+
+func withDeleted(ctx context.Context) bool {
+	ok, _ := ctx.Value(withDeletedKey).(bool)
+	return ok
+}
+
+func (h *Helper) matchColl(name, db, coll string) bool {
+	d, c, err := h.Resolve(name)
+	if err != nil {
+		d, c = "", name
+	}
+
+	return c == coll && (d == "" || d == db)
+}
+
+func (h *Helper) auditPolicy(db, coll string) (AuditPolicy, bool) {
+	for name, policy := range h.Audit.Policies {
+		if h.matchColl(name, db, coll) {
+			return policy, true
+		}
+	}
+
+	return AuditPolicy{}, false
+}
+
+func (h *Helper) softDelete(db, coll string) bool {
+	policy, ok := h.auditPolicy(db, coll)
+	return ok && policy.SoftDelete
+}
+
+func toDoc(v interface{}) (bson.D, error) {
+	if v == nil {
+		return bson.D{}, nil
+	}
+
+	if d, ok := v.(bson.D); ok {
+		return append(bson.D{}, d...), nil
+	}
+
+	b, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	d := bson.D{}
+	err = bson.Unmarshal(b, &d)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func lookupKey(d bson.D, key string) (interface{}, bool) {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+func setKey(d bson.D, key string, value interface{}) bson.D {
+	for i, e := range d {
+		if e.Key == key {
+			d[i].Value = value
+			return d
+		}
+	}
+
+	return append(d, bson.E{Key: key, Value: value})
+}
+
+func removeKey(d bson.D, key string) bson.D {
+	for i, e := range d {
+		if e.Key == key {
+			return append(d[:i], d[i+1:]...)
+		}
+	}
+
+	return d
+}
+
+func isZeroValue(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case time.Time:
+		return v.IsZero()
+	case primitive.DateTime:
+		return v.Time().IsZero()
+	}
+
+	return false
+}
+
+func isSet(d bson.D, key string) bool {
+	v, ok := lookupKey(d, key)
+	return ok && !isZeroValue(v)
+}
+
+func isReplacement(d bson.D) bool {
+	return len(d) > 0 && !strings.HasPrefix(d[0].Key, "$")
+}
+
+func (h *Helper) scopeFilter(ctx context.Context, db, coll string, filter interface{}) (interface{}, error) {
+	if !h.softDelete(db, coll) || withDeleted(ctx) {
+		return filter, nil
+	}
+
+	d, err := toDoc(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	_, ok := lookupKey(d, h.Audit.Fields.DeletedAt)
+	if ok {
+		return d, nil
+	}
+
+	return append(d, bson.E{Key: h.Audit.Fields.DeletedAt, Value: nil}), nil
+}
+
+func (h *Helper) stampInsert(ctx context.Context, db, coll string, data interface{}) (interface{}, error) {
+	policy, ok := h.auditPolicy(db, coll)
+	if !ok {
+		return data, nil
+	}
+
+	d, err := toDoc(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if policy.SoftDelete && !isSet(d, h.Audit.Fields.DeletedAt) {
+		d = removeKey(d, h.Audit.Fields.DeletedAt)
+	}
+
+	if !policy.Timestamps {
+		return d, nil
+	}
+
+	now := time.Now().UTC()
+	if !isSet(d, h.Audit.Fields.CreatedAt) {
+		d = setKey(d, h.Audit.Fields.CreatedAt, now)
+	}
+	d = setKey(d, h.Audit.Fields.UpdatedAt, now)
+
+	actor := ActorFromContext(ctx)
+	if actor != "" && !isSet(d, h.Audit.Fields.CreatedBy) {
+		d = setKey(d, h.Audit.Fields.CreatedBy, actor)
+	}
+
+	return d, nil
+}
+
+func (h *Helper) stampInsertMany(ctx context.Context, db, coll string, data []interface{}) ([]interface{}, error) {
+	if _, ok := h.auditPolicy(db, coll); !ok {
+		return data, nil
+	}
+
+	stamped := make([]interface{}, len(data))
+	for i, doc := range data {
+		d, err := h.stampInsert(ctx, db, coll, doc)
+		if err != nil {
+			return nil, err
+		}
+		stamped[i] = d
+	}
+
+	return stamped, nil
+}
+
+func (h *Helper) stampUpdate(ctx context.Context, db, coll string, update interface{}) (interface{}, error) {
+	policy, ok := h.auditPolicy(db, coll)
+	if !ok {
+		return update, nil
+	}
+
+	switch update.(type) {
+	case bson.A, []bson.D, []bson.M, []interface{}, Pipeline:
+		return update, nil
+	}
+
+	d, err := toDoc(update)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if isReplacement(d) {
+		if policy.SoftDelete && !isSet(d, h.Audit.Fields.DeletedAt) {
+			d = removeKey(d, h.Audit.Fields.DeletedAt)
+		}
+		if policy.Timestamps {
+			d = setKey(d, h.Audit.Fields.UpdatedAt, now)
+		}
+
+		return d, nil
+	}
+
+	v, _ := lookupKey(d, "$set")
+	set, err := toDoc(v)
+	if err != nil {
+		return nil, err
+	}
+
+	v, _ = lookupKey(d, "$setOnInsert")
+	onInsert, err := toDoc(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if policy.SoftDelete && !isSet(set, h.Audit.Fields.DeletedAt) {
+		set = removeKey(set, h.Audit.Fields.DeletedAt)
+	}
+
+	if policy.Timestamps {
+		set = setKey(set, h.Audit.Fields.UpdatedAt, now)
+
+		if !isSet(set, h.Audit.Fields.CreatedAt) {
+			set = removeKey(set, h.Audit.Fields.CreatedAt)
+			if !isSet(onInsert, h.Audit.Fields.CreatedAt) {
+				onInsert = setKey(onInsert, h.Audit.Fields.CreatedAt, now)
+			}
+		}
+
+		actor := ActorFromContext(ctx)
+		if !isSet(set, h.Audit.Fields.CreatedBy) {
+			set = removeKey(set, h.Audit.Fields.CreatedBy)
+			if actor != "" && !isSet(onInsert, h.Audit.Fields.CreatedBy) {
+				onInsert = setKey(onInsert, h.Audit.Fields.CreatedBy, actor)
+			}
+		}
+	}
+
+	if len(set) > 0 {
+		d = setKey(d, "$set", set)
+	} else {
+		d = removeKey(d, "$set")
+	}
+
+	if len(onInsert) > 0 {
+		d = setKey(d, "$setOnInsert", onInsert)
+	}
+
+	return d, nil
+}
+
+func (h *Helper) softDeleteUpdate(db, coll string) bson.D {
+	now := time.Now().UTC()
+	set := bson.D{{Key: h.Audit.Fields.DeletedAt, Value: now}}
+
+	policy, _ := h.auditPolicy(db, coll)
+	if policy.Timestamps {
+		set = append(set, bson.E{Key: h.Audit.Fields.UpdatedAt, Value: now})
+	}
+
+	return bson.D{{Key: "$set", Value: set}}
+}
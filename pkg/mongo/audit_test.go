@@ -0,0 +1,170 @@
+package mongo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAuditTimestamps(t *testing.T) {
+	ctx := mongo.WithActor(context.Background(), "alice")
+	h, f := newHelper(t, mongo.AuditCollection("users", mongo.AuditPolicy{Timestamps: true}))
+
+	err := h.InsertCtx(ctx, testDB, "users", bson.M{"_id": "u1", "name": "bob"})
+	if err != nil {
+		t.Fatalf("insert failed: %s", err.Error())
+	}
+
+	doc := f.Docs(testDB, "users")[0]
+	created, ok := doc["createdAt"].(primitive.DateTime)
+	if !ok || doc["updatedAt"] != created || doc["createdBy"] != "alice" {
+		t.Fatalf("insert was not stamped: %v", doc)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	err = h.UpdateOneCtx(ctx, testDB, "users", bson.M{"_id": "u1"}, bson.M{"$set": bson.M{"name": "carol"}})
+	if err != nil {
+		t.Fatalf("update failed: %s", err.Error())
+	}
+
+	doc = f.Docs(testDB, "users")[0]
+	updated, _ := doc["updatedAt"].(primitive.DateTime)
+	if doc["createdAt"] != created || updated <= created {
+		t.Errorf("update did not keep createdAt and bump updatedAt: %v", doc)
+	}
+}
+
+func TestSoftDeleteScoping(t *testing.T) {
+	ctx := context.Background()
+	h, f := newHelper(t, mongo.AuditCollection("users", mongo.AuditPolicy{SoftDelete: true}))
+	repo, err := mongo.NewRepository[user](h, testDB, "users")
+	if err != nil {
+		t.Fatalf("failed to create repository: %s", err.Error())
+	}
+
+	for _, u := range []user{{ID: "u1", Name: "alice"}, {ID: "u2", Name: "bob"}, {ID: "u3", Name: "carol"}} {
+		err = repo.Insert(ctx, u)
+		if err != nil {
+			t.Fatalf("insert failed: %s", err.Error())
+		}
+	}
+
+	err = repo.Delete(ctx, bson.M{"_id": "u1"})
+	if err != nil {
+		t.Fatalf("delete failed: %s", err.Error())
+	}
+	if n := len(f.Docs(testDB, "users")); n != 3 {
+		t.Fatalf("expected the deleted document to remain, got %d documents", n)
+	}
+
+	tests := []struct {
+		name string
+		run  func() (int, error)
+		want int
+	}{
+		{
+			name: "count",
+			run: func() (int, error) {
+				n, err := repo.Count(ctx, bson.M{})
+				return int(n), err
+			},
+			want: 2,
+		},
+		{
+			name: "count with deleted",
+			run: func() (int, error) {
+				n, err := repo.Count(mongo.WithDeleted(ctx), bson.M{})
+				return int(n), err
+			},
+			want: 3,
+		},
+		{
+			name: "explicit deleted filter",
+			run: func() (int, error) {
+				n, err := repo.Count(ctx, bson.M{"deletedAt": bson.M{"$ne": nil}})
+				return int(n), err
+			},
+			want: 1,
+		},
+		{
+			name: "find many",
+			run: func() (int, error) {
+				users, err := repo.FindMany(ctx, bson.M{}, mongo.Paging{})
+				return len(users), err
+			},
+			want: 2,
+		},
+		{
+			name: "page",
+			run: func() (int, error) {
+				users, _, err := repo.Page(ctx, bson.M{}, mongo.PageRequest{})
+				return len(users), err
+			},
+			want: 2,
+		},
+		{
+			name: "helper count",
+			run: func() (int, error) {
+				n, err := h.GetCount(testDB, "users", bson.M{})
+				return int(n), err
+			},
+			want: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.run()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if got != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+
+	notFound := []struct {
+		name string
+		run  func() error
+	}{
+		{
+			name: "find one",
+			run: func() error {
+				_, err := repo.FindOne(ctx, bson.M{"_id": "u1"})
+				return err
+			},
+		},
+		{
+			name: "update",
+			run: func() error {
+				return repo.Update(ctx, bson.M{"_id": "u1"}, bson.M{"$set": bson.M{"name": "zed"}})
+			},
+		},
+		{
+			name: "delete twice",
+			run: func() error {
+				return repo.Delete(ctx, bson.M{"_id": "u1"})
+			},
+		},
+	}
+
+	for _, tt := range notFound {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run()
+			if !errors.Is(err, mongo.ErrNotFound) {
+				t.Errorf("expected ErrNotFound, got %v", err)
+			}
+		})
+	}
+
+	u, err := repo.FindOne(mongo.WithDeleted(ctx), bson.M{"_id": "u1"})
+	if err != nil || u.Name != "alice" {
+		t.Errorf("expected the deleted user with WithDeleted, got %+v, %v", u, err)
+	}
+}
@@ -0,0 +1,342 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	BulkInsert     BulkOpKind = "insert"
+	BulkUpdateOne  BulkOpKind = "updateOne"
+	BulkUpdateMany BulkOpKind = "updateMany"
+	BulkReplaceOne BulkOpKind = "replaceOne"
+	BulkDeleteOne  BulkOpKind = "deleteOne"
+	BulkDeleteMany BulkOpKind = "deleteMany"
+
+	// Deletes on soft-delete collections are sent as updates, so they count
+	// towards MatchedCount and ModifiedCount instead of DeletedCount.
+	BulkSoftDeleteOne  BulkOpKind = "softDeleteOne"
+	BulkSoftDeleteMany BulkOpKind = "softDeleteMany"
+)
+
+var (
+	ErrBulkNotExecuted = errors.New("bulk operation was not executed because an earlier ordered operation failed")
+)
+
+type BulkOpKind string
+
+type BulkOpResult struct {
+	Index      int         `json:"index"`
+	Kind       BulkOpKind  `json:"kind"`
+	Applied    bool        `json:"applied"`
+	UpsertedID interface{} `json:"upsertedId,omitempty"`
+	Err        error       `json:"-"`
+}
+
+type BulkResult struct {
+	InsertedCount int64          `json:"insertedCount"`
+	MatchedCount  int64          `json:"matchedCount"`
+	ModifiedCount int64          `json:"modifiedCount"`
+	DeletedCount  int64          `json:"deletedCount"`
+	UpsertedCount int64          `json:"upsertedCount"`
+	Ops           []BulkOpResult `json:"ops"`
+}
+
+type BulkError struct {
+	Errors      map[int]error
+	Err         error
+	NotExecuted int
+}
+
+func (e *BulkError) Error() string {
+	msg := fmt.Sprintf("bulk write failed with %d operation errors", len(e.Errors))
+	if e.NotExecuted > 0 {
+		msg += fmt.Sprintf(" and %d operations not executed", e.NotExecuted)
+	}
+
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+
+	return msg
+}
+
+func (e *BulkError) Unwrap() error {
+	return e.Err
+}
+
+type BulkWriter struct {
+	ctx       context.Context
+	h         *Helper
+	c         CollClient
+	db        string
+	coll      string
+	batchSize int
+	ordered   bool
+	kinds     []BulkOpKind
+	models    []mongo.WriteModel
+	result    *BulkResult
+	bulkErr   *BulkError
+	stopped   bool
+	err       error
+}
+
+func (h *Helper) Bulk(ctx context.Context, db, coll string) (*BulkWriter, error) {
+	c, err := h.NewCollCli(db, coll)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BulkWriter{
+		ctx:       ctx,
+		h:         h,
+		c:         c,
+		db:        db,
+		coll:      coll,
+		batchSize: h.BulkWrite.BatchSize,
+		ordered:   h.BulkWrite.Ordered,
+	}, nil
+}
+
+func (b *BulkWriter) BatchSize(size int) *BulkWriter {
+	b.batchSize = size
+	return b
+}
+
+func (b *BulkWriter) Ordered(ordered bool) *BulkWriter {
+	b.ordered = ordered
+	return b
+}
+
+func (b *BulkWriter) add(kind BulkOpKind, model mongo.WriteModel) *BulkWriter {
+	b.kinds = append(b.kinds, kind)
+	b.models = append(b.models, model)
+	if b.batchSize > 0 && len(b.models) >= b.batchSize && b.err == nil {
+		b.flushPending()
+	}
+
+	return b
+}
+
+func (b *BulkWriter) fail(err error) *BulkWriter {
+	if b.err == nil {
+		b.err = err
+	}
+
+	return b
+}
+
+func (b *BulkWriter) Insert(doc interface{}) *BulkWriter {
+	doc, err := b.h.encrypt(b.db, b.coll, doc)
+	if err != nil {
+		return b.fail(err)
+	}
+
+	doc, err = b.h.stampInsert(b.ctx, b.db, b.coll, doc)
+	if err != nil {
+		return b.fail(err)
+	}
+
+	return b.add(BulkInsert, mongo.NewInsertOneModel().SetDocument(doc))
+}
+
+func (b *BulkWriter) UpdateOne(filter, update interface{}, upsert bool) *BulkWriter {
+	update, err := b.h.encryptUpdate(b.db, b.coll, update)
+	if err != nil {
+		return b.fail(err)
+	}
+
+	update, err = b.h.stampUpdate(b.ctx, b.db, b.coll, update)
+	if err != nil {
+		return b.fail(err)
+	}
+
+	return b.add(BulkUpdateOne, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(upsert))
+}
+
+func (b *BulkWriter) UpdateMany(filter, update interface{}, upsert bool) *BulkWriter {
+	update, err := b.h.encryptUpdate(b.db, b.coll, update)
+	if err != nil {
+		return b.fail(err)
+	}
+
+	update, err = b.h.stampUpdate(b.ctx, b.db, b.coll, update)
+	if err != nil {
+		return b.fail(err)
+	}
+
+	return b.add(BulkUpdateMany, mongo.NewUpdateManyModel().SetFilter(filter).SetUpdate(update).SetUpsert(upsert))
+}
+
+func (b *BulkWriter) ReplaceOne(filter, doc interface{}, upsert bool) *BulkWriter {
+	doc, err := b.h.encrypt(b.db, b.coll, doc)
+	if err != nil {
+		return b.fail(err)
+	}
+
+	doc, err = b.h.stampUpdate(b.ctx, b.db, b.coll, doc)
+	if err != nil {
+		return b.fail(err)
+	}
+
+	return b.add(BulkReplaceOne, mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(doc).SetUpsert(upsert))
+}
+
+func (b *BulkWriter) DeleteOne(filter interface{}) *BulkWriter {
+	if !b.h.softDelete(b.db, b.coll) {
+		return b.add(BulkDeleteOne, mongo.NewDeleteOneModel().SetFilter(filter))
+	}
+
+	filter, err := b.h.scopeFilter(b.ctx, b.db, b.coll, filter)
+	if err != nil {
+		return b.fail(err)
+	}
+
+	return b.add(BulkSoftDeleteOne, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(b.h.softDeleteUpdate(b.db, b.coll)))
+}
+
+func (b *BulkWriter) DeleteMany(filter interface{}) *BulkWriter {
+	if !b.h.softDelete(b.db, b.coll) {
+		return b.add(BulkDeleteMany, mongo.NewDeleteManyModel().SetFilter(filter))
+	}
+
+	filter, err := b.h.scopeFilter(b.ctx, b.db, b.coll, filter)
+	if err != nil {
+		return b.fail(err)
+	}
+
+	return b.add(BulkSoftDeleteMany, mongo.NewUpdateManyModel().SetFilter(filter).SetUpdate(b.h.softDeleteUpdate(b.db, b.coll)))
+}
+
+func (b *BulkWriter) Len() int {
+	return len(b.models)
+}
+
+func (b *BulkWriter) flushPending() {
+	if b.result == nil {
+		b.result = &BulkResult{Ops: []BulkOpResult{}}
+		b.bulkErr = &BulkError{Errors: map[int]error{}}
+	}
+
+	kinds, models := b.kinds, b.models
+	b.kinds, b.models = nil, nil
+
+	base := len(b.result.Ops)
+	for i, kind := range kinds {
+		b.result.Ops = append(b.result.Ops, BulkOpResult{Index: base + i, Kind: kind})
+	}
+
+	batchSize := b.batchSize
+	if batchSize <= 0 {
+		batchSize = len(models)
+	}
+
+	for offset := 0; offset < len(models); offset += batchSize {
+		end := offset + batchSize
+		if end > len(models) {
+			end = len(models)
+		}
+
+		if !b.stopped {
+			b.stopped = b.flushBatch(base+offset, models[offset:end], b.result, b.bulkErr)
+			continue
+		}
+
+		for i := base + offset; i < base+end; i++ {
+			b.result.Ops[i].Err = ErrBulkNotExecuted
+			b.bulkErr.NotExecuted++
+		}
+	}
+}
+
+func (b *BulkWriter) Flush() (*BulkResult, error) {
+	err := b.err
+	if err == nil {
+		b.flushPending()
+	}
+
+	result, bulkErr := b.result, b.bulkErr
+	b.kinds, b.models, b.result, b.bulkErr, b.stopped, b.err = nil, nil, nil, nil, false, nil
+	if err != nil {
+		return result, fmt.Errorf("failed to build bulk operations: %w", err)
+	}
+
+	if len(bulkErr.Errors) > 0 || bulkErr.Err != nil {
+		return result, bulkErr
+	}
+
+	return result, nil
+}
+
+func (b *BulkWriter) flushBatch(offset int, models []mongo.WriteModel, result *BulkResult, bulkErr *BulkError) bool {
+	ctx, cancel := b.h.withTimeout(b.ctx)
+	defer cancel()
+
+	res, err := b.c.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(b.ordered))
+	if res != nil {
+		result.InsertedCount += res.InsertedCount
+		result.MatchedCount += res.MatchedCount
+		result.ModifiedCount += res.ModifiedCount
+		result.DeletedCount += res.DeletedCount
+		result.UpsertedCount += res.UpsertedCount
+		for i, id := range res.UpsertedIDs {
+			result.Ops[offset+int(i)].UpsertedID = id
+		}
+	}
+
+	if err == nil {
+		for i := range models {
+			result.Ops[offset+i].Applied = true
+		}
+
+		return false
+	}
+
+	var bwe mongo.BulkWriteException
+	if !errors.As(err, &bwe) {
+		for i := range models {
+			result.Ops[offset+i].Err = err
+			bulkErr.Errors[offset+i] = err
+		}
+		bulkErr.Err = err
+
+		return true
+	}
+
+	failed := map[int]error{}
+	for _, we := range bwe.WriteErrors {
+		failed[we.Index] = we.WriteError
+	}
+
+	firstFailed := len(models)
+	for i := range failed {
+		if i < firstFailed {
+			firstFailed = i
+		}
+	}
+
+	for i := range models {
+		op := &result.Ops[offset+i]
+		if e, ok := failed[i]; ok {
+			op.Err = e
+			bulkErr.Errors[offset+i] = e
+			continue
+		}
+
+		op.Applied = !b.ordered || i < firstFailed
+		if !op.Applied {
+			op.Err = ErrBulkNotExecuted
+			bulkErr.NotExecuted++
+		}
+	}
+
+	if bwe.WriteConcernError != nil {
+		bulkErr.Err = bwe.WriteConcernError
+	}
+
+	return b.ordered && len(failed) > 0
+}
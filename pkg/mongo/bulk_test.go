@@ -0,0 +1,168 @@
+package mongo_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestBulkWriter(t *testing.T) {
+	tests := []struct {
+		name        string
+		ordered     bool
+		batchSize   int
+		ids         []string
+		wantApplied []bool
+		wantErrs    []int
+		wantDocs    int
+	}{
+		{
+			name:        "single batch",
+			ordered:     true,
+			ids:         []string{"a", "b", "c"},
+			wantApplied: []bool{true, true, true},
+			wantDocs:    3,
+		},
+		{
+			name:        "ordered stops at the first failure",
+			ordered:     true,
+			batchSize:   2,
+			ids:         []string{"a", "b", "a", "c", "d"},
+			wantApplied: []bool{true, true, false, false, false},
+			wantErrs:    []int{2},
+			wantDocs:    2,
+		},
+		{
+			name:        "unordered keeps going",
+			batchSize:   2,
+			ids:         []string{"a", "b", "a", "c", "d"},
+			wantApplied: []bool{true, true, false, true, true},
+			wantErrs:    []int{2},
+			wantDocs:    4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, f := newHelper(t)
+			b, err := h.Bulk(context.Background(), testDB, "items")
+			if err != nil {
+				t.Fatalf("failed to create bulk writer: %s", err.Error())
+			}
+			b.Ordered(tt.ordered).BatchSize(tt.batchSize)
+
+			for _, id := range tt.ids {
+				b.Insert(bson.M{"_id": id})
+			}
+
+			result, err := b.Flush()
+			var bulkErr *mongo.BulkError
+			if len(tt.wantErrs) > 0 && !errors.As(err, &bulkErr) {
+				t.Fatalf("expected a bulk error, got %v", err)
+			}
+			if len(tt.wantErrs) == 0 && err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+
+			applied := []bool{}
+			for i, op := range result.Ops {
+				if op.Index != i || op.Kind != mongo.BulkInsert {
+					t.Errorf("unexpected op %d: %+v", i, op)
+				}
+				applied = append(applied, op.Applied)
+			}
+			if !reflect.DeepEqual(applied, tt.wantApplied) {
+				t.Errorf("expected applied %v, got %v", tt.wantApplied, applied)
+			}
+
+			if bulkErr != nil {
+				errs := []int{}
+				for i := range bulkErr.Errors {
+					errs = append(errs, i)
+				}
+				if !reflect.DeepEqual(errs, tt.wantErrs) {
+					t.Errorf("expected errors at %v, got %v", tt.wantErrs, bulkErr.Errors)
+				}
+			}
+
+			if n := len(f.Docs(testDB, "items")); n != tt.wantDocs {
+				t.Errorf("expected %d documents, got %d", tt.wantDocs, n)
+			}
+		})
+	}
+}
+
+func TestBulkWriterAutoFlush(t *testing.T) {
+	h, f := newHelper(t)
+	b, err := h.Bulk(context.Background(), testDB, "items")
+	if err != nil {
+		t.Fatalf("failed to create bulk writer: %s", err.Error())
+	}
+	b.BatchSize(2)
+
+	b.Insert(bson.M{"_id": "a"})
+	if n := len(f.Docs(testDB, "items")); n != 0 {
+		t.Fatalf("expected no documents before the batch is full, got %d", n)
+	}
+
+	b.Insert(bson.M{"_id": "b"}).Insert(bson.M{"_id": "c"})
+	if n := len(f.Docs(testDB, "items")); n != 2 {
+		t.Fatalf("expected a full batch to be flushed, got %d documents", n)
+	}
+	if b.Len() != 1 {
+		t.Fatalf("expected 1 pending operation, got %d", b.Len())
+	}
+
+	result, err := b.Flush()
+	if err != nil {
+		t.Fatalf("flush failed: %s", err.Error())
+	}
+	if len(result.Ops) != 3 || result.InsertedCount != 3 {
+		t.Errorf("expected 3 inserted operations, got %+v", result)
+	}
+	if n := len(f.Docs(testDB, "items")); n != 3 {
+		t.Errorf("expected 3 documents, got %d", n)
+	}
+}
+
+func TestBulkWriterSoftDelete(t *testing.T) {
+	h, f := newHelper(t, mongo.AuditCollection("items", mongo.AuditPolicy{SoftDelete: true}))
+	err := f.Seed(testDB, "items", bson.M{"_id": "a"}, bson.M{"_id": "b"}, bson.M{"_id": "c"})
+	if err != nil {
+		t.Fatalf("seed failed: %s", err.Error())
+	}
+
+	b, err := h.Bulk(context.Background(), testDB, "items")
+	if err != nil {
+		t.Fatalf("failed to create bulk writer: %s", err.Error())
+	}
+
+	result, err := b.DeleteOne(bson.M{"_id": "a"}).DeleteMany(bson.M{"_id": bson.M{"$in": bson.A{"b", "c"}}}).Flush()
+	if err != nil {
+		t.Fatalf("flush failed: %s", err.Error())
+	}
+
+	kinds := []mongo.BulkOpKind{result.Ops[0].Kind, result.Ops[1].Kind}
+	if !reflect.DeepEqual(kinds, []mongo.BulkOpKind{mongo.BulkSoftDeleteOne, mongo.BulkSoftDeleteMany}) {
+		t.Errorf("expected soft delete kinds, got %v", kinds)
+	}
+	if result.DeletedCount != 0 || result.ModifiedCount != 3 {
+		t.Errorf("expected 3 modified and 0 deleted, got %+v", result)
+	}
+
+	if n := len(f.Docs(testDB, "items")); n != 3 {
+		t.Errorf("expected soft deleted documents to remain, got %d", n)
+	}
+
+	count, err := h.GetCount(testDB, "items", bson.M{})
+	if err != nil {
+		t.Fatalf("count failed: %s", err.Error())
+	}
+	if count != 0 {
+		t.Errorf("expected soft deleted documents to be hidden, got %d", count)
+	}
+}
@@ -0,0 +1,480 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/duration"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	namespaceNotFoundCode = 26
+)
+
+func isNamespaceNotFound(err error) bool {
+	var se mongo.ServerError
+	return errors.As(err, &se) && se.HasErrorCode(namespaceNotFoundCode)
+}
+
+func (h *Helper) SetValidator(ctx context.Context, db, coll string, schema bson.M) error {
+	dbCli, err := h.NewDBCli(db)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := h.withTimeout(ctx)
+	defer cancel()
+
+	validator := bson.M{"$jsonSchema": schema}
+	err = dbCli.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: coll},
+		{Key: "validator", Value: validator},
+	}).Err()
+	if !isNamespaceNotFound(err) {
+		return err
+	}
+
+	return dbCli.RunCommand(ctx, bson.D{
+		{Key: "create", Value: coll},
+		{Key: "validator", Value: validator},
+	}).Err()
+}
+
+type TTL struct {
+	Field       string            `json:"field" yaml:"field"`
+	ExpireAfter duration.Duration `json:"expireAfter" yaml:"expireAfter"`
+}
+
+func (t TTL) index() Index {
+	seconds := int32(t.ExpireAfter.Std() / time.Second)
+	return Index{
+		Keys:               bson.D{{Key: t.Field, Value: 1}},
+		ExpireAfterSeconds: &seconds,
+	}
+}
+
+type Collation struct {
+	Locale   string `json:"locale" yaml:"locale" bson:"locale"`
+	Strength int    `json:"strength" yaml:"strength" bson:"strength,omitempty"`
+}
+
+type CollectionSpec struct {
+	Capped       bool       `json:"capped" yaml:"capped"`
+	SizeBytes    int64      `json:"sizeBytes" yaml:"sizeBytes"`
+	MaxDocuments int64      `json:"maxDocuments" yaml:"maxDocuments"`
+	Collation    *Collation `json:"collation" yaml:"collation"`
+	Schema       bson.M     `json:"schema" yaml:"schema"`
+	TTL          *TTL       `json:"ttl" yaml:"ttl"`
+	Indexes      []Index    `json:"indexes" yaml:"indexes"`
+
+	// RebuildIndexes lets EnsureCollection drop and recreate indexes whose
+	// unique or sparse options drifted. Without it the drift is only reported.
+	RebuildIndexes bool `json:"rebuildIndexes" yaml:"rebuildIndexes"`
+}
+
+type Drift struct {
+	Field    string      `json:"field" yaml:"field"`
+	Expected interface{} `json:"expected" yaml:"expected"`
+	Actual   interface{} `json:"actual" yaml:"actual"`
+	Fixed    bool        `json:"fixed" yaml:"fixed"`
+}
+
+func (d Drift) String() string {
+	state := "unfixed"
+	if d.Fixed {
+		state = "fixed"
+	}
+
+	return fmt.Sprintf("%s: expected %v, actual %v (%s)", d.Field, d.Expected, d.Actual, state)
+}
+
+type liveCollection struct {
+	Options struct {
+		Capped    bool       `bson:"capped"`
+		Size      int64      `bson:"size"`
+		Max       int64      `bson:"max"`
+		Collation *Collation `bson:"collation"`
+		Validator bson.Raw   `bson:"validator"`
+	} `bson:"options"`
+	Indexes []liveIndex `bson:"-"`
+}
+
+type liveIndex struct {
+	Name               string   `bson:"name"`
+	Key                bson.Raw `bson:"key"`
+	Unique             bool     `bson:"unique"`
+	Sparse             bool     `bson:"sparse"`
+	ExpireAfterSeconds *int32   `bson:"expireAfterSeconds"`
+}
+
+type cursorReply[T any] struct {
+	Cursor struct {
+		FirstBatch []T `bson:"firstBatch"`
+	} `bson:"cursor"`
+}
+
+func normalize(v interface{}) (bson.M, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	b, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	m := bson.M{}
+	err = bson.Unmarshal(b, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func keyValue(v interface{}) string {
+	switch n := v.(type) {
+	case int32:
+		return fmt.Sprint(float64(n))
+	case int64:
+		return fmt.Sprint(float64(n))
+	case int:
+		return fmt.Sprint(float64(n))
+	case float64:
+		return fmt.Sprint(n)
+	}
+
+	return fmt.Sprint(v)
+}
+
+func sameKeys(a bson.Raw, b bson.D) bool {
+	got := bson.D{}
+	err := bson.Unmarshal(a, &got)
+	if err != nil {
+		return false
+	}
+
+	if len(got) != len(b) {
+		return false
+	}
+
+	for i := range b {
+		if got[i].Key != b[i].Key || keyValue(got[i].Value) != keyValue(b[i].Value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func roundCappedSize(size int64) int64 {
+	if size%256 == 0 {
+		return size
+	}
+
+	return size + 256 - size%256
+}
+
+func (h *Helper) inspectCollection(ctx context.Context, dbCli DBClient, coll string) (*liveCollection, error) {
+	reply := cursorReply[liveCollection]{}
+	err := dbCli.RunCommand(ctx, bson.D{
+		{Key: "listCollections", Value: 1},
+		{Key: "filter", Value: bson.M{"name": coll}},
+	}).Decode(&reply)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reply.Cursor.FirstBatch) == 0 {
+		return nil, nil
+	}
+
+	live := &reply.Cursor.FirstBatch[0]
+	indexes := cursorReply[liveIndex]{}
+	err = dbCli.RunCommand(ctx, bson.D{{Key: "listIndexes", Value: coll}}).Decode(&indexes)
+	if err != nil && !isNamespaceNotFound(err) {
+		return nil, err
+	}
+	live.Indexes = indexes.Cursor.FirstBatch
+
+	return live, nil
+}
+
+func (spec CollectionSpec) indexes() []Index {
+	indexes := append([]Index{}, spec.Indexes...)
+	if spec.TTL != nil {
+		indexes = append(indexes, spec.TTL.index())
+	}
+
+	return indexes
+}
+
+func (spec CollectionSpec) validate(db, coll string) error {
+	if spec.Capped && spec.SizeBytes <= 0 {
+		return fmt.Errorf("capped collection %s.%s requires a positive size", db, coll)
+	}
+
+	if spec.TTL != nil && (spec.TTL.Field == "" || spec.TTL.ExpireAfter.Std() < time.Second) {
+		return fmt.Errorf(
+			"ttl of %s.%s requires a field and an expiry of at least 1s. values: field(%s); expireAfter(%s)",
+			db,
+			coll,
+			spec.TTL.Field,
+			spec.TTL.ExpireAfter,
+		)
+	}
+
+	return nil
+}
+
+func diffCollection(spec CollectionSpec, live *liveCollection) ([]Drift, error) {
+	drifts := []Drift{}
+	if spec.Capped != live.Options.Capped {
+		drifts = append(drifts, Drift{Field: "capped", Expected: spec.Capped, Actual: live.Options.Capped})
+	}
+
+	if spec.Capped && roundCappedSize(spec.SizeBytes) != roundCappedSize(live.Options.Size) {
+		drifts = append(drifts, Drift{Field: "size", Expected: spec.SizeBytes, Actual: live.Options.Size})
+	}
+
+	if spec.Capped && spec.MaxDocuments != live.Options.Max {
+		drifts = append(drifts, Drift{Field: "max", Expected: spec.MaxDocuments, Actual: live.Options.Max})
+	}
+
+	if spec.Collation != nil || live.Options.Collation != nil {
+		var want, got Collation
+		if spec.Collation != nil {
+			want = *spec.Collation
+		}
+		if live.Options.Collation != nil {
+			got = *live.Options.Collation
+		}
+
+		if want.Locale != got.Locale || (want.Strength != 0 && want.Strength != got.Strength) {
+			drifts = append(drifts, Drift{Field: "collation", Expected: want, Actual: got})
+		}
+	}
+
+	if spec.Schema != nil {
+		want, err := normalize(bson.M{"$jsonSchema": spec.Schema})
+		if err != nil {
+			return nil, err
+		}
+
+		var got bson.M
+		if len(live.Options.Validator) > 0 {
+			got, err = normalize(live.Options.Validator)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if !reflect.DeepEqual(want, got) {
+			drifts = append(drifts, Drift{Field: "validator", Expected: want, Actual: got})
+		}
+	}
+
+	for _, i := range spec.indexes() {
+		var found *liveIndex
+		for n := range live.Indexes {
+			if sameKeys(live.Indexes[n].Key, i.Keys) {
+				found = &live.Indexes[n]
+				break
+			}
+		}
+
+		field := "index " + i.name()
+		if found == nil {
+			drifts = append(drifts, Drift{Field: field, Expected: i.doc()})
+			continue
+		}
+
+		if i.Unique != found.Unique || i.Sparse != found.Sparse {
+			drifts = append(drifts, Drift{
+				Field:    field + " options",
+				Expected: bson.M{"unique": i.Unique, "sparse": i.Sparse},
+				Actual:   bson.M{"unique": found.Unique, "sparse": found.Sparse},
+			})
+		}
+
+		if i.ExpireAfterSeconds != nil && (found.ExpireAfterSeconds == nil || *found.ExpireAfterSeconds != *i.ExpireAfterSeconds) {
+			var actual interface{}
+			if found.ExpireAfterSeconds != nil {
+				actual = *found.ExpireAfterSeconds
+			}
+			drifts = append(drifts, Drift{Field: field + " expireAfterSeconds", Expected: *i.ExpireAfterSeconds, Actual: actual})
+		}
+	}
+
+	return drifts, nil
+}
+
+func (h *Helper) DiffCollection(ctx context.Context, db, coll string, spec CollectionSpec) ([]Drift, error) {
+	err := spec.validate(db, coll)
+	if err != nil {
+		return nil, err
+	}
+
+	dbCli, err := h.NewDBCli(db)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := h.withTimeout(ctx)
+	defer cancel()
+
+	live, err := h.inspectCollection(ctx, dbCli, coll)
+	if err != nil {
+		return nil, err
+	}
+
+	if live == nil {
+		return []Drift{{Field: "collection", Expected: coll}}, nil
+	}
+
+	return diffCollection(spec, live)
+}
+
+func (h *Helper) EnsureCollection(ctx context.Context, db, coll string, spec CollectionSpec) ([]Drift, error) {
+	err := spec.validate(db, coll)
+	if err != nil {
+		return nil, err
+	}
+
+	dbCli, err := h.NewDBCli(db)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := h.withTimeout(ctx)
+	defer cancel()
+
+	live, err := h.inspectCollection(ctx, dbCli, coll)
+	if err != nil {
+		return nil, err
+	}
+
+	if live == nil {
+		err = h.createCollection(ctx, dbCli, coll, spec)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, h.EnsureIndexes(ctx, db, coll, spec.indexes()...)
+	}
+
+	drifts, err := diffCollection(spec, live)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, d := range drifts {
+		drifts[i].Fixed, err = h.fixDrift(ctx, dbCli, db, coll, spec, live, d)
+		if err != nil {
+			return drifts, err
+		}
+	}
+
+	return drifts, nil
+}
+
+func (h *Helper) createCollection(ctx context.Context, dbCli DBClient, coll string, spec CollectionSpec) error {
+	cmd := bson.D{{Key: "create", Value: coll}}
+	if spec.Capped {
+		cmd = append(cmd, bson.E{Key: "capped", Value: true}, bson.E{Key: "size", Value: spec.SizeBytes})
+		if spec.MaxDocuments > 0 {
+			cmd = append(cmd, bson.E{Key: "max", Value: spec.MaxDocuments})
+		}
+	}
+
+	if spec.Collation != nil {
+		cmd = append(cmd, bson.E{Key: "collation", Value: spec.Collation})
+	}
+
+	if spec.Schema != nil {
+		cmd = append(cmd, bson.E{Key: "validator", Value: bson.M{"$jsonSchema": spec.Schema}})
+	}
+
+	return dbCli.RunCommand(ctx, cmd).Err()
+}
+
+func (h *Helper) fixDrift(ctx context.Context, dbCli DBClient, db, coll string, spec CollectionSpec, live *liveCollection, d Drift) (bool, error) {
+	switch {
+	case d.Field == "validator":
+		err := dbCli.RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: coll},
+			{Key: "validator", Value: bson.M{"$jsonSchema": spec.Schema}},
+		}).Err()
+		return err == nil, err
+	case strings.HasSuffix(d.Field, " expireAfterSeconds"):
+		for _, i := range spec.indexes() {
+			if "index "+i.name()+" expireAfterSeconds" != d.Field {
+				continue
+			}
+
+			err := dbCli.RunCommand(ctx, bson.D{
+				{Key: "collMod", Value: coll},
+				{Key: "index", Value: bson.D{
+					{Key: "keyPattern", Value: i.Keys},
+					{Key: "expireAfterSeconds", Value: *i.ExpireAfterSeconds},
+				}},
+			}).Err()
+			return err == nil, err
+		}
+	case strings.HasSuffix(d.Field, " options") && spec.RebuildIndexes:
+		for _, i := range spec.indexes() {
+			if "index "+i.name()+" options" != d.Field {
+				continue
+			}
+
+			for _, found := range live.Indexes {
+				if !sameKeys(found.Key, i.Keys) {
+					continue
+				}
+
+				err := dbCli.RunCommand(ctx, bson.D{
+					{Key: "dropIndexes", Value: coll},
+					{Key: "index", Value: found.Name},
+				}).Err()
+				if err != nil {
+					return false, err
+				}
+
+				err = h.EnsureIndexes(ctx, db, coll, i)
+				return err == nil, err
+			}
+		}
+	case strings.HasPrefix(d.Field, "index ") && d.Actual == nil:
+		for _, i := range spec.indexes() {
+			if "index "+i.name() == d.Field {
+				err := h.EnsureIndexes(ctx, db, coll, i)
+				return err == nil, err
+			}
+		}
+	}
+
+	return false, nil
+}
+
+func (h *Helper) DropCollection(ctx context.Context, db, coll string) error {
+	dbCli, err := h.NewDBCli(db)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := h.withTimeout(ctx)
+	defer cancel()
+
+	err = dbCli.RunCommand(ctx, bson.D{{Key: "drop", Value: coll}}).Err()
+	if isNamespaceNotFound(err) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,118 @@
+package mongo_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/duration"
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCollectionSpecDurations(t *testing.T) {
+	spec := mongo.CollectionSpec{}
+	err := json.Unmarshal([]byte(`{"ttl": {"field": "createdAt", "expireAfter": "1h30m"}}`), &spec)
+	if err != nil {
+		t.Fatalf("failed to unmarshal spec: %s", err.Error())
+	}
+
+	if spec.TTL.ExpireAfter.Std() != 90*time.Minute {
+		t.Errorf("expected 1h30m, got %s", spec.TTL.ExpireAfter)
+	}
+}
+
+func TestEnsureCollection(t *testing.T) {
+	ttl := &mongo.TTL{Field: "createdAt", ExpireAfter: duration.Duration(time.Hour)}
+	email := mongo.Index{Keys: bson.D{{Key: "email", Value: 1}}, Unique: true}
+
+	tests := []struct {
+		name      string
+		existing  *mongo.CollectionSpec
+		spec      mongo.CollectionSpec
+		wantDrift map[string]bool
+	}{
+		{
+			name: "create",
+			spec: mongo.CollectionSpec{TTL: ttl, Indexes: []mongo.Index{email}},
+		},
+		{
+			name:      "in sync",
+			existing:  &mongo.CollectionSpec{TTL: ttl, Indexes: []mongo.Index{email}},
+			spec:      mongo.CollectionSpec{TTL: ttl, Indexes: []mongo.Index{email}},
+			wantDrift: map[string]bool{},
+		},
+		{
+			name:     "ttl changed",
+			existing: &mongo.CollectionSpec{TTL: &mongo.TTL{Field: "createdAt", ExpireAfter: duration.Duration(time.Minute)}},
+			spec:     mongo.CollectionSpec{TTL: ttl},
+			wantDrift: map[string]bool{
+				"index createdAt_1 expireAfterSeconds": true,
+			},
+		},
+		{
+			name:     "missing index",
+			existing: &mongo.CollectionSpec{},
+			spec:     mongo.CollectionSpec{Indexes: []mongo.Index{email}},
+			wantDrift: map[string]bool{
+				"index email_1": true,
+			},
+		},
+		{
+			name:     "unique drift reported",
+			existing: &mongo.CollectionSpec{Indexes: []mongo.Index{{Keys: email.Keys}}},
+			spec:     mongo.CollectionSpec{Indexes: []mongo.Index{email}},
+			wantDrift: map[string]bool{
+				"index email_1 options": false,
+			},
+		},
+		{
+			name:     "unique drift rebuilt",
+			existing: &mongo.CollectionSpec{Indexes: []mongo.Index{{Keys: email.Keys}}},
+			spec:     mongo.CollectionSpec{Indexes: []mongo.Index{email}, RebuildIndexes: true},
+			wantDrift: map[string]bool{
+				"index email_1 options": true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h, _ := newHelper(t)
+
+			if tt.existing != nil {
+				_, err := h.EnsureCollection(ctx, testDB, "users", *tt.existing)
+				if err != nil {
+					t.Fatalf("failed to create existing collection: %s", err.Error())
+				}
+			}
+
+			drifts, err := h.EnsureCollection(ctx, testDB, "users", tt.spec)
+			if err != nil {
+				t.Fatalf("ensure failed: %s", err.Error())
+			}
+
+			if len(drifts) != len(tt.wantDrift) {
+				t.Fatalf("expected drifts %v, got %v", tt.wantDrift, drifts)
+			}
+			for _, d := range drifts {
+				fixed, ok := tt.wantDrift[d.Field]
+				if !ok || fixed != d.Fixed {
+					t.Errorf("unexpected drift %s", d)
+				}
+			}
+
+			remaining, err := h.DiffCollection(ctx, testDB, "users", tt.spec)
+			if err != nil {
+				t.Fatalf("diff failed: %s", err.Error())
+			}
+			for _, d := range remaining {
+				if tt.wantDrift[d.Field] {
+					t.Errorf("drift %s was reported fixed but remains", d)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,767 @@
+package mongo
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	secureTag        = "secure"
+	ciphertextPrefix = "enc:v1:"
+)
+
+var (
+	ErrKeyNotFound           = errors.New("encryption key not found")
+	ErrEncryptionDisabled    = errors.New("encryption is not configured")
+	ErrMalformedCiphertext   = errors.New("malformed ciphertext")
+	ErrUncheckedSecureUpdate = errors.New("update cannot be checked for secure fields")
+	ErrUnsupportedSecureTag  = errors.New("secure tag is not supported on this field")
+
+	securePathsCache sync.Map
+)
+
+type KeyProvider interface {
+	Current() (string, []byte, error)
+	Key(id string) ([]byte, error)
+}
+
+type Keyring struct {
+	current string
+	keys    map[string][]byte
+}
+
+func NewKeyring(current string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("current key %q is not in the keyring", current)
+	}
+
+	for id, key := range keys {
+		if strings.Contains(id, ":") {
+			return nil, fmt.Errorf("key id %q must not contain ':'", id)
+		}
+
+		switch len(key) {
+		case 16, 24, 32:
+		default:
+			return nil, fmt.Errorf("key %q must be 16, 24 or 32 bytes, got %d", id, len(key))
+		}
+	}
+
+	return &Keyring{current: current, keys: keys}, nil
+}
+
+func (k *Keyring) Current() (string, []byte, error) {
+	return k.current, k.keys[k.current], nil
+}
+
+func (k *Keyring) Key(id string) ([]byte, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, id)
+	}
+
+	return key, nil
+}
+
+type encryption struct {
+	once     sync.Once
+	provider KeyProvider
+	err      error
+
+	mu    sync.Mutex
+	paths map[string]map[string]bool
+}
+
+func (h *Helper) keyProvider() (KeyProvider, error) {
+	h.encryption.once.Do(func() {
+		if h.Encryption.KeyProvider != nil {
+			h.encryption.provider = h.Encryption.KeyProvider
+			return
+		}
+
+		if len(h.Encryption.Keys) == 0 {
+			return
+		}
+
+		keys := map[string][]byte{}
+		for id, encoded := range h.Encryption.Keys {
+			key, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				h.encryption.err = fmt.Errorf("decode encryption key %q: %w", id, err)
+				return
+			}
+			keys[id] = key
+		}
+
+		h.encryption.provider, h.encryption.err = NewKeyring(h.Encryption.CurrentKey, keys)
+	})
+
+	return h.encryption.provider, h.encryption.err
+}
+
+func (h *Helper) currentKey() (string, []byte, error) {
+	p, err := h.keyProvider()
+	if err != nil {
+		return "", nil, err
+	}
+	if p == nil {
+		return "", nil, ErrEncryptionDisabled
+	}
+
+	return p.Current()
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (h *Helper) seal(value interface{}) (string, error) {
+	id, key, err := h.currentKey()
+	if err != nil {
+		return "", err
+	}
+
+	plain, err := bson.Marshal(bson.D{{Key: "v", Value: value}})
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plain, []byte(id))
+	return ciphertextPrefix + id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func ciphertextKey(s string) (string, string, bool) {
+	if !strings.HasPrefix(s, ciphertextPrefix) {
+		return "", "", false
+	}
+
+	id, payload, ok := strings.Cut(strings.TrimPrefix(s, ciphertextPrefix), ":")
+	return id, payload, ok
+}
+
+func (h *Helper) open(s string) (interface{}, error) {
+	id, payload, ok := ciphertextKey(s)
+	if !ok {
+		return nil, ErrMalformedCiphertext
+	}
+
+	p, err := h.keyProvider()
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, ErrEncryptionDisabled
+	}
+
+	key, err := p.Key(id)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMalformedCiphertext, err.Error())
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrMalformedCiphertext
+	}
+
+	nonce, sealed := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, sealed, []byte(id))
+	if err != nil {
+		return nil, err
+	}
+
+	return bson.Raw(plain).Lookup("v"), nil
+}
+
+type secureWalker struct {
+	seen      map[reflect.Type]bool
+	recursive reflect.Type
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+func containerElem(t reflect.Type) (reflect.Type, bool) {
+	t = indirectType(t)
+	container := false
+	for t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = indirectType(t.Elem())
+		container = true
+	}
+
+	return t, container
+}
+
+func (w *secureWalker) paths(t reflect.Type, prefix string) ([]string, error) {
+	t = indirectType(t)
+	if t.Kind() != reflect.Struct {
+		return nil, nil
+	}
+
+	if w.seen[t] {
+		w.recursive = t
+		return nil, nil
+	}
+	w.seen[t] = true
+	defer delete(w.seen, t)
+
+	paths := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		tag := f.Tag.Get("bson")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+
+		if strings.Contains(","+opts+",", ",inline,") {
+			nested, err := w.paths(f.Type, prefix)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, nested...)
+			continue
+		}
+
+		if f.Tag.Get(secureTag) == "true" {
+			paths = append(paths, prefix+name)
+			continue
+		}
+
+		if elem, ok := containerElem(f.Type); ok {
+			nested, err := w.paths(elem, prefix+name+".")
+			if err != nil {
+				return nil, err
+			}
+			if len(nested) > 0 {
+				return nil, fmt.Errorf(
+					"%w: secure fields inside slices, arrays or maps cannot be encrypted, tag the whole field instead. values: type(%s); field(%s)",
+					ErrUnsupportedSecureTag,
+					t,
+					prefix+name,
+				)
+			}
+			continue
+		}
+
+		nested, err := w.paths(f.Type, prefix+name+".")
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, nested...)
+	}
+
+	if w.recursive == t {
+		w.recursive = nil
+		if len(paths) > 0 {
+			return nil, fmt.Errorf("%w: secure fields inside recursive types cannot be encrypted. values: type(%s)", ErrUnsupportedSecureTag, t)
+		}
+	}
+
+	return paths, nil
+}
+
+type securePathsResult struct {
+	paths []string
+	err   error
+}
+
+func securePaths(t reflect.Type) ([]string, error) {
+	if t == nil {
+		return nil, nil
+	}
+
+	if cached, ok := securePathsCache.Load(t); ok {
+		r := cached.(securePathsResult)
+		return r.paths, r.err
+	}
+
+	w := &secureWalker{seen: map[reflect.Type]bool{}}
+	paths, err := w.paths(t, "")
+	securePathsCache.Store(t, securePathsResult{paths: paths, err: err})
+
+	return paths, err
+}
+
+func (h *Helper) learnSecure(db, coll string, t reflect.Type) error {
+	paths, err := securePaths(t)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	h.encryption.mu.Lock()
+	defer h.encryption.mu.Unlock()
+
+	if h.encryption.paths == nil {
+		h.encryption.paths = map[string]map[string]bool{}
+	}
+
+	ns := db + "." + coll
+	if h.encryption.paths[ns] == nil {
+		h.encryption.paths[ns] = map[string]bool{}
+	}
+	for _, p := range paths {
+		h.encryption.paths[ns][p] = true
+	}
+
+	return nil
+}
+
+func (h *Helper) secureFieldPaths(db, coll string) map[string]bool {
+	paths := map[string]bool{}
+	for name, fields := range h.Encryption.Fields {
+		if !h.matchColl(name, db, coll) {
+			continue
+		}
+
+		for _, f := range fields {
+			paths[f] = true
+		}
+	}
+
+	h.encryption.mu.Lock()
+	defer h.encryption.mu.Unlock()
+	for p := range h.encryption.paths[db+"."+coll] {
+		paths[p] = true
+	}
+
+	return paths
+}
+
+func hasSecureChild(paths map[string]bool, path string) bool {
+	for p := range paths {
+		if strings.HasPrefix(p, path+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func underSecure(paths map[string]bool, path string) bool {
+	for p := range paths {
+		if strings.HasPrefix(path, p+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func asDoc(v interface{}) (bson.D, bool) {
+	switch v.(type) {
+	case bson.D, bson.M, map[string]interface{}, bson.Raw:
+	default:
+		t := reflect.TypeOf(v)
+		for t != nil && t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t == nil || (t.Kind() != reflect.Struct && t.Kind() != reflect.Map) {
+			return nil, false
+		}
+	}
+
+	d, err := toDoc(v)
+	if err != nil {
+		return nil, false
+	}
+
+	return d, true
+}
+
+func (h *Helper) encryptPaths(d bson.D, prefix string, paths map[string]bool) (bson.D, error) {
+	for i, e := range d {
+		path := prefix + e.Key
+		if underSecure(paths, path) {
+			return nil, fmt.Errorf("%w: field is nested in a secure field. values: field(%s)", ErrUncheckedSecureUpdate, path)
+		}
+
+		if paths[path] {
+			if e.Value == nil {
+				continue
+			}
+
+			sealed, err := h.seal(e.Value)
+			if err != nil {
+				return nil, fmt.Errorf("encrypt field %s: %w", path, err)
+			}
+			d[i].Value = sealed
+			continue
+		}
+
+		if !hasSecureChild(paths, path) {
+			continue
+		}
+
+		sub, ok := asDoc(e.Value)
+		if !ok {
+			if e.Value == nil {
+				continue
+			}
+			return nil, fmt.Errorf("%w: secure fields can only be nested in documents. values: field(%s)", ErrUnsupportedSecureTag, path)
+		}
+
+		sub, err := h.encryptPaths(sub, path+".", paths)
+		if err != nil {
+			return nil, err
+		}
+		d[i].Value = sub
+	}
+
+	return d, nil
+}
+
+func (h *Helper) encrypt(db, coll string, data interface{}) (interface{}, error) {
+	if data == nil {
+		return data, nil
+	}
+
+	err := h.learnSecure(db, coll, reflect.TypeOf(data))
+	if err != nil {
+		return nil, err
+	}
+
+	paths := h.secureFieldPaths(db, coll)
+	if len(paths) == 0 {
+		return data, nil
+	}
+
+	_, key, err := h.currentKey()
+	if err == nil {
+		_, err = newGCM(key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt secure fields. values: db(%s); coll(%s): %w", db, coll, err)
+	}
+
+	d, err := toDoc(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.encryptPaths(d, "", paths)
+}
+
+func (h *Helper) encryptMany(db, coll string, data []interface{}) ([]interface{}, error) {
+	encrypted := make([]interface{}, len(data))
+	for i, doc := range data {
+		d, err := h.encrypt(db, coll, doc)
+		if err != nil {
+			return nil, err
+		}
+		encrypted[i] = d
+	}
+
+	return encrypted, nil
+}
+
+func (h *Helper) encryptUpdate(db, coll string, update interface{}) (interface{}, error) {
+	if update == nil {
+		return update, nil
+	}
+
+	switch update.(type) {
+	case bson.A, []bson.D, []bson.M, []interface{}, Pipeline:
+		if len(h.secureFieldPaths(db, coll)) > 0 {
+			return nil, fmt.Errorf("%w: pipeline update. values: db(%s); coll(%s)", ErrUncheckedSecureUpdate, db, coll)
+		}
+		return update, nil
+	}
+
+	d, err := toDoc(update)
+	if err != nil {
+		return nil, err
+	}
+
+	if isReplacement(d) {
+		return h.encrypt(db, coll, update)
+	}
+
+	for i, e := range d {
+		if e.Key != "$set" && e.Key != "$setOnInsert" {
+			continue
+		}
+
+		v, err := h.encrypt(db, coll, e.Value)
+		if err != nil {
+			return nil, err
+		}
+		d[i].Value = v
+	}
+
+	paths := h.secureFieldPaths(db, coll)
+	for _, e := range d {
+		if e.Key == "$set" || e.Key == "$setOnInsert" || e.Key == "$unset" {
+			continue
+		}
+
+		fields, ok := asDoc(e.Value)
+		if !ok {
+			continue
+		}
+
+		for _, f := range fields {
+			if paths[f.Key] || hasSecureChild(paths, f.Key) || underSecure(paths, f.Key) {
+				return nil, fmt.Errorf(
+					"%w: operator cannot be applied to a secure field. values: operator(%s); field(%s)",
+					ErrUncheckedSecureUpdate,
+					e.Key,
+					f.Key,
+				)
+			}
+		}
+	}
+
+	return d, nil
+}
+
+func (h *Helper) decryptValue(v bson.RawValue, path string, paths map[string]bool) (interface{}, bool, error) {
+	if paths[path] {
+		if v.Type != bson.TypeString {
+			return nil, false, nil
+		}
+
+		s := v.StringValue()
+		if _, _, ok := ciphertextKey(s); !ok {
+			return nil, false, nil
+		}
+
+		plain, err := h.open(s)
+		if err != nil {
+			return nil, false, err
+		}
+
+		return plain, true, nil
+	}
+
+	if v.Type == bson.TypeEmbeddedDocument && hasSecureChild(paths, path) {
+		return h.decryptRaw(v.Document(), path+".", paths)
+	}
+
+	return nil, false, nil
+}
+
+func (h *Helper) decryptRaw(raw bson.Raw, prefix string, paths map[string]bool) (bson.D, bool, error) {
+	elems, err := raw.Elements()
+	if err != nil {
+		return nil, false, err
+	}
+
+	d := bson.D{}
+	changed := false
+	for _, e := range elems {
+		v, ok, err := h.decryptValue(e.Value(), prefix+e.Key(), paths)
+		if err != nil {
+			return nil, false, fmt.Errorf("decrypt field %s: %w", prefix+e.Key(), err)
+		}
+
+		if ok {
+			changed = true
+			d = append(d, bson.E{Key: e.Key(), Value: v})
+			continue
+		}
+
+		d = append(d, bson.E{Key: e.Key(), Value: e.Value()})
+	}
+
+	return d, changed, nil
+}
+
+// Decrypt opens the secure fields of a document read from db.coll. Only paths
+// declared with EncryptFields or learned from secure-tagged types are opened;
+// any other value is returned as stored.
+func (h *Helper) Decrypt(db, coll string, raw bson.Raw) (bson.Raw, error) {
+	paths := h.secureFieldPaths(db, coll)
+	if len(paths) == 0 {
+		return raw, nil
+	}
+
+	d, changed, err := h.decryptRaw(raw, "", paths)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return raw, nil
+	}
+
+	return bson.Marshal(d)
+}
+
+func (h *Helper) decode(db, coll string, raw bson.Raw, v interface{}) error {
+	raw, err := h.Decrypt(db, coll, raw)
+	if err != nil {
+		return err
+	}
+
+	return bson.Unmarshal(raw, v)
+}
+
+func (h *Helper) decryptResult(db, coll string, result *mongo.SingleResult) *mongo.SingleResult {
+	if len(h.secureFieldPaths(db, coll)) == 0 {
+		return result
+	}
+
+	raw, err := result.Raw()
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+
+	raw, err = h.Decrypt(db, coll, raw)
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+
+	return mongo.NewSingleResultFromDocument(raw, nil, nil)
+}
+
+func (h *Helper) Reencrypt(ctx context.Context, db, coll string) (int64, error) {
+	current, _, err := h.currentKey()
+	if err != nil {
+		return 0, err
+	}
+
+	c, err := h.NewCollCli(db, coll)
+	if err != nil {
+		return 0, err
+	}
+
+	paths := h.secureFieldPaths(db, coll)
+	cursor, err := c.Find(ctx, bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(context.Background())
+
+	var rotated int64
+	for cursor.Next(ctx) {
+		set := bson.D{}
+		err = h.rotateFields(cursor.Current, "", current, paths, &set)
+		if err != nil {
+			return rotated, err
+		}
+		if len(set) == 0 {
+			continue
+		}
+
+		update, err := h.stampUpdate(ctx, db, coll, bson.D{{Key: "$set", Value: set}})
+		if err != nil {
+			return rotated, err
+		}
+
+		err = h.rotateOne(ctx, c, cursor.Current.Lookup("_id"), update)
+		if err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+
+	return rotated, cursor.Err()
+}
+
+func (h *Helper) rotateOne(ctx context.Context, c CollClient, id bson.RawValue, update interface{}) error {
+	ctx, cancel := h.withTimeout(ctx)
+	defer cancel()
+	_, err := c.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+func (h *Helper) rotateFields(raw bson.Raw, prefix, current string, paths map[string]bool, set *bson.D) error {
+	elems, err := raw.Elements()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range elems {
+		path := prefix + e.Key()
+		v := e.Value()
+		if !paths[path] {
+			if v.Type == bson.TypeEmbeddedDocument && hasSecureChild(paths, path) {
+				err = h.rotateFields(v.Document(), path+".", current, paths, set)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if v.Type == bson.TypeNull {
+			continue
+		}
+
+		id, encrypted := "", false
+		if v.Type == bson.TypeString {
+			id, _, encrypted = ciphertextKey(v.StringValue())
+		}
+
+		var plain interface{} = v
+		if encrypted {
+			if id == current {
+				continue
+			}
+
+			plain, err = h.open(v.StringValue())
+			if err != nil {
+				return fmt.Errorf("decrypt field %s: %w", path, err)
+			}
+		}
+
+		sealed, err := h.seal(plain)
+		if err != nil {
+			return fmt.Errorf("encrypt field %s: %w", path, err)
+		}
+		*set = append(*set, bson.E{Key: path, Value: sealed})
+	}
+
+	return nil
+}
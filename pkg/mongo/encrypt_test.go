@@ -0,0 +1,259 @@
+package mongo_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/mongo"
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/mongo/mongotest"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	testDB = "db"
+)
+
+var (
+	testKeys = map[string]string{
+		"k1": base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")),
+		"k2": base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210")),
+	}
+)
+
+type account struct {
+	ID       string `bson:"_id"`
+	Name     string `bson:"name"`
+	Password string `bson:"password" secure:"true"`
+	Profile  struct {
+		Phone string `bson:"phone" secure:"true"`
+	} `bson:"profile"`
+}
+
+type card struct {
+	Number string `bson:"number" secure:"true"`
+}
+
+type wallet struct {
+	ID    string `bson:"_id"`
+	Cards []card `bson:"cards"`
+}
+
+func newHelper(t *testing.T, opts ...mongo.Option) (*mongo.Helper, *mongotest.Fake) {
+	t.Helper()
+
+	h, f, err := mongotest.NewHelper(opts...)
+	if err != nil {
+		t.Fatalf("failed to create helper: %s", err.Error())
+	}
+
+	return h, f
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	h, f := newHelper(t, mongo.EncryptionKeys("k1", testKeys))
+	repo, err := mongo.NewRepository[account](h, testDB, "accounts")
+	if err != nil {
+		t.Fatalf("failed to create repository: %s", err.Error())
+	}
+
+	in := account{ID: "a1", Name: "alice", Password: "s3cret"}
+	in.Profile.Phone = "555-0100"
+	err = repo.Insert(ctx, in)
+	if err != nil {
+		t.Fatalf("insert failed: %s", err.Error())
+	}
+
+	stored := f.Docs(testDB, "accounts")[0]
+	if stored["name"] != "alice" {
+		t.Errorf("plain field was changed: %v", stored["name"])
+	}
+	if s, _ := stored["password"].(string); !strings.HasPrefix(s, "enc:v1:k1:") {
+		t.Errorf("password was not encrypted: %v", stored["password"])
+	}
+	if s, _ := stored["profile"].(bson.M)["phone"].(string); !strings.HasPrefix(s, "enc:v1:k1:") {
+		t.Errorf("nested phone was not encrypted: %v", stored["profile"])
+	}
+
+	out, err := repo.FindOne(ctx, bson.M{"_id": "a1"})
+	if err != nil {
+		t.Fatalf("find failed: %s", err.Error())
+	}
+	if out != in {
+		t.Errorf("round trip mismatch. got %+v, want %+v", out, in)
+	}
+
+	got := account{}
+	result, err := h.Get(testDB, "accounts", bson.M{"_id": "a1"})
+	if err != nil {
+		t.Fatalf("get failed: %s", err.Error())
+	}
+	err = result.Decode(&got)
+	if err != nil {
+		t.Fatalf("decode failed: %s", err.Error())
+	}
+	if got != in {
+		t.Errorf("get mismatch. got %+v, want %+v", got, in)
+	}
+
+	aggregated, err := mongo.Aggregate[account](ctx, h, testDB, "accounts", mongo.NewPipeline())
+	if err != nil {
+		t.Fatalf("aggregate failed: %s", err.Error())
+	}
+	if len(aggregated) != 1 || aggregated[0] != in {
+		t.Errorf("aggregate mismatch. got %+v, want %+v", aggregated, in)
+	}
+
+	page, _, err := repo.Page(ctx, bson.M{}, mongo.PageRequest{})
+	if err != nil {
+		t.Fatalf("page failed: %s", err.Error())
+	}
+	if len(page) != 1 || page[0] != in {
+		t.Errorf("page mismatch. got %+v, want %+v", page, in)
+	}
+}
+
+func TestEncryptFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []mongo.Option
+		run  func(*mongo.Helper) error
+		want error
+	}{
+		{
+			name: "no key configured",
+			run: func(h *mongo.Helper) error {
+				repo, err := mongo.NewRepository[account](h, testDB, "accounts")
+				if err != nil {
+					return err
+				}
+				return repo.Insert(context.Background(), account{ID: "a1", Password: "s3cret"})
+			},
+			want: mongo.ErrEncryptionDisabled,
+		},
+		{
+			name: "no key for declared fields",
+			opts: []mongo.Option{mongo.EncryptFields("accounts", "password")},
+			run: func(h *mongo.Helper) error {
+				return h.Insert(testDB, "accounts", bson.M{"_id": "a1", "password": "s3cret"})
+			},
+			want: mongo.ErrEncryptionDisabled,
+		},
+		{
+			name: "malformed key",
+			opts: []mongo.Option{mongo.EncryptionKeys("k1", map[string]string{"k1": "not base64!"})},
+			run: func(h *mongo.Helper) error {
+				return h.Insert(testDB, "accounts", account{ID: "a1", Password: "s3cret"})
+			},
+		},
+		{
+			name: "secure field in slice",
+			opts: []mongo.Option{mongo.EncryptionKeys("k1", testKeys)},
+			run: func(h *mongo.Helper) error {
+				_, err := mongo.NewRepository[wallet](h, testDB, "wallets")
+				return err
+			},
+			want: mongo.ErrUnsupportedSecureTag,
+		},
+		{
+			name: "secure field in slice on insert",
+			opts: []mongo.Option{mongo.EncryptionKeys("k1", testKeys)},
+			run: func(h *mongo.Helper) error {
+				return h.Insert(testDB, "wallets", wallet{ID: "w1", Cards: []card{{Number: "4111"}}})
+			},
+			want: mongo.ErrUnsupportedSecureTag,
+		},
+		{
+			name: "operator on secure field",
+			opts: []mongo.Option{mongo.EncryptionKeys("k1", testKeys), mongo.EncryptFields("accounts", "password")},
+			run: func(h *mongo.Helper) error {
+				return h.UpdateOne(testDB, "accounts", bson.M{"_id": "a1"}, bson.M{"$rename": bson.M{"password": "pw"}})
+			},
+			want: mongo.ErrUncheckedSecureUpdate,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, f := newHelper(t, tt.opts...)
+			err := tt.run(h)
+			if err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+			if docs := f.Docs(testDB, "accounts"); len(docs) != 0 {
+				t.Errorf("document was written in plaintext: %v", docs)
+			}
+		})
+	}
+}
+
+func TestDecryptOnlySecurePaths(t *testing.T) {
+	ctx := context.Background()
+	h, f := newHelper(t, mongo.EncryptionKeys("k1", testKeys))
+	repo, err := mongo.NewRepository[account](h, testDB, "accounts")
+	if err != nil {
+		t.Fatalf("failed to create repository: %s", err.Error())
+	}
+
+	err = f.Seed(testDB, "accounts", bson.M{"_id": "a1", "name": "enc:v1:zz:abc"})
+	if err != nil {
+		t.Fatalf("seed failed: %s", err.Error())
+	}
+
+	out, err := repo.FindOne(ctx, bson.M{"_id": "a1"})
+	if err != nil {
+		t.Fatalf("find failed: %s", err.Error())
+	}
+	if out.Name != "enc:v1:zz:abc" {
+		t.Errorf("plain field was changed: %q", out.Name)
+	}
+}
+
+func TestReencrypt(t *testing.T) {
+	ctx := context.Background()
+	h, f := newHelper(t, mongo.EncryptionKeys("k1", testKeys))
+	repo, err := mongo.NewRepository[account](h, testDB, "accounts")
+	if err != nil {
+		t.Fatalf("failed to create repository: %s", err.Error())
+	}
+
+	err = repo.Insert(ctx, account{ID: "a1", Password: "s3cret"})
+	if err != nil {
+		t.Fatalf("insert failed: %s", err.Error())
+	}
+
+	rotated, err := mongo.NewHelperWithBackend(f, mongo.EncryptionKeys("k2", testKeys))
+	if err != nil {
+		t.Fatalf("failed to create helper: %s", err.Error())
+	}
+	_, err = mongo.NewRepository[account](rotated, testDB, "accounts")
+	if err != nil {
+		t.Fatalf("failed to create repository: %s", err.Error())
+	}
+
+	n, err := rotated.Reencrypt(ctx, testDB, "accounts")
+	if err != nil {
+		t.Fatalf("reencrypt failed: %s", err.Error())
+	}
+	if n != 1 {
+		t.Errorf("expected 1 rotated document, got %d", n)
+	}
+
+	if s, _ := f.Docs(testDB, "accounts")[0]["password"].(string); !strings.HasPrefix(s, "enc:v1:k2:") {
+		t.Errorf("password was not rotated: %v", s)
+	}
+
+	out, err := repo.FindOne(ctx, bson.M{"_id": "a1"})
+	if err != nil {
+		t.Fatalf("find failed: %s", err.Error())
+	}
+	if out.Password != "s3cret" {
+		t.Errorf("expected password s3cret, got %q", out.Password)
+	}
+}
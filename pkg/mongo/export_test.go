@@ -0,0 +1,18 @@
+package mongo
+
+import (
+	"context"
+)
+
+type ChangeStreamClient = changeStream
+
+var IsResumableWatchErr = isResumableWatchErr
+
+func ConsumeChangeStream(ctx context.Context, h *Helper, db, coll string, stream ChangeStreamClient, handler ChangeHandler) (bool, error) {
+	w, err := h.newWatcher(ctx, db, coll, nil, handler)
+	if err != nil {
+		return false, err
+	}
+
+	return w.consume(ctx, stream)
+}
@@ -0,0 +1,159 @@
+package mongo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "go-micro.dev/v5/logger"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+const (
+	ConnStateConnected    ConnState = "connected"
+	ConnStateDisconnected ConnState = "disconnected"
+)
+
+type ConnState string
+
+type StateHandler func(ConnState, error)
+
+type inflight struct {
+	mu     sync.Mutex
+	active int
+	idle   chan struct{}
+}
+
+func (i *inflight) begin() func() {
+	i.mu.Lock()
+	i.active++
+	i.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(i.end)
+	}
+}
+
+func (i *inflight) end() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.active--
+	if i.active == 0 && i.idle != nil {
+		close(i.idle)
+		i.idle = nil
+	}
+}
+
+func (i *inflight) wait(ctx context.Context) error {
+	i.mu.Lock()
+	if i.active == 0 {
+		i.mu.Unlock()
+		return nil
+	}
+
+	if i.idle == nil {
+		i.idle = make(chan struct{})
+	}
+	idle := i.idle
+	i.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *Helper) Ping(ctx context.Context) error {
+	ctx, cancel := h.withTimeout(ctx)
+	defer cancel()
+
+	if h.Backend != nil {
+		return h.Backend.Ping(ctx)
+	}
+
+	return h.Client.Ping(ctx, readpref.Primary())
+}
+
+func (h *Helper) StartMonitor(ctx context.Context, handler StateHandler) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	h.monitorMu.Lock()
+	if h.monitorCancel != nil {
+		h.monitorCancel()
+	}
+	h.monitorCancel = cancel
+	h.monitorMu.Unlock()
+
+	go h.monitor(ctx, handler)
+}
+
+func (h *Helper) StopMonitor() {
+	h.monitorMu.Lock()
+	defer h.monitorMu.Unlock()
+
+	if h.monitorCancel != nil {
+		h.monitorCancel()
+		h.monitorCancel = nil
+	}
+}
+
+func (h *Helper) monitor(ctx context.Context, handler StateHandler) {
+	interval := h.Health.Interval
+	if interval <= 0 {
+		interval = defaultHealthInterval
+	}
+
+	ticker := time.NewTicker(interval.Std())
+	defer ticker.Stop()
+
+	var last ConnState
+	for {
+		err := h.Ping(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		state := ConnStateConnected
+		if err != nil {
+			state = ConnStateDisconnected
+		}
+
+		if state != last {
+			if err != nil {
+				log.Warnf("mongo connection state changed to %s: %s", state, err.Error())
+			} else {
+				log.Infof("mongo connection state changed to %s", state)
+			}
+
+			if handler != nil {
+				handler(state, err)
+			}
+			last = state
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Helper) CloseCtx(ctx context.Context) error {
+	h.StopMonitor()
+
+	err := h.inflight.wait(ctx)
+	if err != nil {
+		log.Warnf("closing mongo connection with in-flight operations: %s", err.Error())
+	}
+
+	if h.Backend != nil {
+		return h.Backend.Disconnect(ctx)
+	}
+
+	return h.Client.Disconnect(ctx)
+}
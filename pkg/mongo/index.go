@@ -0,0 +1,79 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type Index struct {
+	Keys               bson.D `json:"keys" yaml:"keys"`
+	Name               string `json:"name" yaml:"name"`
+	Unique             bool   `json:"unique" yaml:"unique"`
+	Sparse             bool   `json:"sparse" yaml:"sparse"`
+	ExpireAfterSeconds *int32 `json:"expireAfterSeconds" yaml:"expireAfterSeconds"`
+	PartialFilter      bson.M `json:"partialFilter" yaml:"partialFilter"`
+}
+
+func (i Index) name() string {
+	if i.Name != "" {
+		return i.Name
+	}
+
+	parts := []string{}
+	for _, k := range i.Keys {
+		parts = append(parts, fmt.Sprintf("%s_%v", k.Key, k.Value))
+	}
+
+	return strings.Join(parts, "_")
+}
+
+func (i Index) doc() bson.D {
+	d := bson.D{
+		{Key: "key", Value: i.Keys},
+		{Key: "name", Value: i.name()},
+	}
+	if i.Unique {
+		d = append(d, bson.E{Key: "unique", Value: true})
+	}
+	if i.Sparse {
+		d = append(d, bson.E{Key: "sparse", Value: true})
+	}
+	if i.ExpireAfterSeconds != nil {
+		d = append(d, bson.E{Key: "expireAfterSeconds", Value: *i.ExpireAfterSeconds})
+	}
+	if i.PartialFilter != nil {
+		d = append(d, bson.E{Key: "partialFilterExpression", Value: i.PartialFilter})
+	}
+
+	return d
+}
+
+func (h *Helper) EnsureIndexes(ctx context.Context, db, coll string, indexes ...Index) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	dbCli, err := h.NewDBCli(db)
+	if err != nil {
+		return err
+	}
+
+	specs := bson.A{}
+	for _, i := range indexes {
+		if len(i.Keys) == 0 {
+			return fmt.Errorf("index keys of %s.%s are empty", db, coll)
+		}
+
+		specs = append(specs, i.doc())
+	}
+
+	ctx, cancel := h.withTimeout(ctx)
+	defer cancel()
+	return dbCli.RunCommand(ctx, bson.D{
+		{Key: "createIndexes", Value: coll},
+		{Key: "indexes", Value: specs},
+	}).Err()
+}
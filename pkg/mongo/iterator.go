@@ -0,0 +1,57 @@
+package mongo
+
+import (
+	"context"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/iterator"
+)
+
+var (
+	ErrStopIteration = iterator.ErrStop
+)
+
+type Stream[T any] struct {
+	*iterator.Stream[T]
+}
+
+type cursorSource[T any] struct {
+	cursor CursorClient
+}
+
+func (c cursorSource[T]) Next(ctx context.Context) bool {
+	return c.cursor.Next(ctx)
+}
+
+func (c cursorSource[T]) Decode() (T, error) {
+	var item T
+	err := c.cursor.Decode(&item)
+	return item, err
+}
+
+func (c cursorSource[T]) Err() error {
+	return c.cursor.Err()
+}
+
+func (c cursorSource[T]) Close() {
+	c.cursor.Close(context.Background())
+}
+
+// Iterate decodes documents as the cursor returns them, so secure fields stay
+// encrypted. Decode into bson.Raw and pass each item to Helper.Decrypt to read
+// them in plain. The stream must be closed, it closes the cursor; ForEach does
+// that itself.
+func Iterate[T any](ctx context.Context, cursor CursorClient, batchSize int32) *Stream[T] {
+	if batchSize > 0 {
+		cursor.SetBatchSize(batchSize)
+	}
+
+	s, _ := iterator.Open(ctx, func(context.Context) (iterator.Source[T], error) {
+		return cursorSource[T]{cursor: cursor}, nil
+	})
+
+	return &Stream[T]{Stream: s}
+}
+
+func ForEach[T any](ctx context.Context, cursor CursorClient, batchSize int32, fn func(T) error) error {
+	return iterator.ForEach(Iterate[T](ctx, cursor, batchSize).Stream, fn)
+}
@@ -0,0 +1,202 @@
+package mongo_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type countingCursor struct {
+	items  []int
+	pos    int
+	err    error
+	closed atomic.Int32
+}
+
+func (c *countingCursor) All(context.Context, interface{}) error {
+	return errors.New("not supported")
+}
+
+func (c *countingCursor) Next(ctx context.Context) bool {
+	if ctx.Err() != nil || c.pos >= len(c.items) {
+		return false
+	}
+
+	c.pos++
+	return true
+}
+
+func (c *countingCursor) Decode(v interface{}) error {
+	b, err := bson.Marshal(bson.M{"n": c.items[c.pos-1]})
+	if err != nil {
+		return err
+	}
+
+	return bson.Unmarshal(b, v)
+}
+
+func (c *countingCursor) Err() error {
+	return c.err
+}
+
+func (c *countingCursor) Close(context.Context) error {
+	c.closed.Add(1)
+	return nil
+}
+
+func (c *countingCursor) SetBatchSize(int32) {}
+
+type item struct {
+	N int `bson:"n"`
+}
+
+func waitClosed(t *testing.T, c *countingCursor) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for c.closed.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("cursor was not closed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if n := c.closed.Load(); n != 1 {
+		t.Errorf("expected cursor to be closed once, got %d", n)
+	}
+}
+
+func TestIterate(t *testing.T) {
+	cursorErr := errors.New("cursor failed")
+
+	tests := []struct {
+		name    string
+		cursor  *countingCursor
+		stop    int
+		want    []int
+		wantErr error
+	}{
+		{
+			name:   "drain",
+			cursor: &countingCursor{items: []int{1, 2, 3}},
+			want:   []int{1, 2, 3},
+		},
+		{
+			name:   "break early",
+			cursor: &countingCursor{items: []int{1, 2, 3}},
+			stop:   1,
+			want:   []int{1},
+		},
+		{
+			name:    "cursor error",
+			cursor:  &countingCursor{items: []int{1}, err: cursorErr},
+			want:    []int{1},
+			wantErr: cursorErr,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := mongo.Iterate[item](context.Background(), tt.cursor, 10)
+
+			got := []int{}
+			for it := range s.C() {
+				got = append(got, it.N)
+				if len(got) == tt.stop {
+					break
+				}
+			}
+
+			err := s.Close()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+
+			waitClosed(t, tt.cursor)
+		})
+	}
+}
+
+func TestIterateErrAfterBreak(t *testing.T) {
+	cursor := &countingCursor{items: []int{1, 2, 3}}
+	s := mongo.Iterate[item](context.Background(), cursor, 0)
+
+	for range s.C() {
+		break
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.Err() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Err blocked after breaking out of the stream")
+	}
+
+	waitClosed(t, cursor)
+}
+
+func TestForEach(t *testing.T) {
+	tests := []struct {
+		name    string
+		fn      func(item) error
+		want    []int
+		wantErr bool
+	}{
+		{
+			name: "all",
+			fn:   func(item) error { return nil },
+			want: []int{1, 2, 3},
+		},
+		{
+			name: "stop",
+			fn: func(it item) error {
+				if it.N == 2 {
+					return mongo.ErrStopIteration
+				}
+				return nil
+			},
+			want: []int{1, 2},
+		},
+		{
+			name: "error",
+			fn: func(it item) error {
+				return errors.New("failed")
+			},
+			want:    []int{1},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor := &countingCursor{items: []int{1, 2, 3}}
+			got := []int{}
+			err := mongo.ForEach(context.Background(), cursor, 0, func(it item) error {
+				got = append(got, it.N)
+				return tt.fn(it)
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+
+			waitClosed(t, cursor)
+		})
+	}
+}
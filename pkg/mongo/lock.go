@@ -0,0 +1,405 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "go-micro.dev/v5/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	minLeaseTTL      = time.Second
+	minRenewInterval = 100 * time.Millisecond
+)
+
+var (
+	ErrLockHeld = errors.New("lock is held by another owner")
+	ErrLockLost = errors.New("lock lease was lost")
+)
+
+type lockRecord struct {
+	Name       string    `bson:"_id"`
+	Owner      string    `bson:"owner"`
+	Token      int64     `bson:"token"`
+	AcquiredAt time.Time `bson:"acquiredAt"`
+	ExpiresAt  time.Time `bson:"expiresAt"`
+}
+
+type Lock struct {
+	h     *Helper
+	coll  func() (CollClient, error)
+	name  string
+	owner string
+	token int64
+	ttl   time.Duration
+
+	mu        sync.Mutex
+	expiresAt time.Time
+	lost      chan struct{}
+	lostOnce  sync.Once
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+func (h *Helper) leaseColl() (CollClient, error) {
+	db := h.Lease.Database
+	if db == "" {
+		db = h.Options.Database
+	}
+
+	if db == "" || h.Lease.Collection == "" {
+		return nil, fmt.Errorf(
+			"lease database or collection is not configured. values: database(%s); collection(%s)",
+			db,
+			h.Lease.Collection,
+		)
+	}
+
+	return h.NewCollCli(db, h.Lease.Collection)
+}
+
+func validateTTL(ttl time.Duration) error {
+	if ttl < minLeaseTTL {
+		return fmt.Errorf("lease ttl is below the minimum. values: ttl(%s); min(%s)", ttl, minLeaseTTL)
+	}
+
+	return nil
+}
+
+func (h *Helper) renewInterval(ttl time.Duration) time.Duration {
+	interval := ttl / 3
+	if h.Lease.RenewInterval > 0 && h.Lease.RenewInterval.Std() < ttl {
+		interval = h.Lease.RenewInterval.Std()
+	}
+
+	if interval < minRenewInterval {
+		return minRenewInterval
+	}
+
+	return interval
+}
+
+func (h *Helper) acquireLease(ctx context.Context, coll func() (CollClient, error), name, owner string, ttl time.Duration) (*lockRecord, error) {
+	c, err := coll()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := h.withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now().UTC()
+	filter := bson.M{
+		"_id": name,
+		"$or": bson.A{
+			bson.M{"owner": owner},
+			bson.M{"expiresAt": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"owner":      owner,
+			"acquiredAt": now,
+			"expiresAt":  now.Add(ttl),
+		},
+		"$inc": bson.M{"token": 1},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	record := &lockRecord{}
+	err = c.FindOneAndUpdate(ctx, filter, update, opts).Decode(record)
+	if mongo.IsDuplicateKeyError(err) || errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrLockHeld
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+func (h *Helper) Lock(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	if name == "" {
+		return nil, fmt.Errorf("lock name is nil. value: name(%s)", name)
+	}
+
+	if ttl <= 0 {
+		ttl = h.Lease.TTL.Std()
+	}
+
+	return h.lockIn(ctx, h.leaseColl, name, ttl)
+}
+
+func (h *Helper) lockIn(ctx context.Context, coll func() (CollClient, error), name string, ttl time.Duration) (*Lock, error) {
+	err := validateTTL(ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	owner := genOwner()
+	record, err := h.acquireLease(ctx, coll, name, owner, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	renewCtx, cancel := context.WithCancel(context.Background())
+	l := &Lock{
+		h:         h,
+		coll:      coll,
+		name:      name,
+		owner:     owner,
+		token:     record.Token,
+		ttl:       ttl,
+		expiresAt: record.ExpiresAt,
+		lost:      make(chan struct{}),
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	go l.renew(renewCtx)
+
+	return l, nil
+}
+
+func (l *Lock) Name() string {
+	return l.name
+}
+
+func (l *Lock) Token() int64 {
+	return l.token
+}
+
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *Lock) markLost() {
+	l.lostOnce.Do(func() {
+		close(l.lost)
+	})
+}
+
+func (l *Lock) renew(ctx context.Context) {
+	defer close(l.done)
+
+	t := time.NewTicker(l.h.renewInterval(l.ttl))
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		err := l.extend(ctx)
+		if err == nil {
+			continue
+		}
+
+		if errors.Is(err, ErrLockLost) {
+			log.Warnf("lock %s lost by %s: lease was taken over", l.name, l.owner)
+			l.markLost()
+			return
+		}
+
+		l.mu.Lock()
+		expired := time.Now().After(l.expiresAt)
+		l.mu.Unlock()
+		if expired {
+			log.Warnf("lock %s lost by %s: lease expired while renewing: %s", l.name, l.owner, err.Error())
+			l.markLost()
+			return
+		}
+
+		log.Errorf("failed to renew lock %s: %s", l.name, err.Error())
+	}
+}
+
+func (l *Lock) Check(ctx context.Context) error {
+	select {
+	case <-l.lost:
+		return ErrLockLost
+	default:
+	}
+
+	c, err := l.coll()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := l.h.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{
+		"_id":       l.name,
+		"owner":     l.owner,
+		"token":     l.token,
+		"expiresAt": bson.M{"$gt": time.Now().UTC()},
+	}
+	err = c.FindOne(ctx, filter).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		l.markLost()
+		return ErrLockLost
+	}
+
+	return err
+}
+
+func (l *Lock) extend(ctx context.Context) error {
+	c, err := l.coll()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := l.h.withTimeout(ctx)
+	defer cancel()
+
+	expiresAt := time.Now().UTC().Add(l.ttl)
+	filter := bson.M{"_id": l.name, "owner": l.owner, "token": l.token}
+	update := bson.M{"$set": bson.M{"expiresAt": expiresAt}}
+
+	err = c.FindOneAndUpdate(ctx, filter, update).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrLockLost
+	}
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.expiresAt = expiresAt
+	l.mu.Unlock()
+
+	return nil
+}
+
+func (l *Lock) Unlock(ctx context.Context) error {
+	l.cancel()
+	<-l.done
+
+	select {
+	case <-l.lost:
+		return ErrLockLost
+	default:
+	}
+	l.markLost()
+
+	c, err := l.coll()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := l.h.withTimeout(ctx)
+	defer cancel()
+	_, err = c.UpdateOne(
+		ctx,
+		bson.M{"_id": l.name, "owner": l.owner, "token": l.token},
+		bson.M{"$set": bson.M{"owner": "", "expiresAt": time.Unix(0, 0).UTC()}},
+	)
+
+	return err
+}
+
+type LeaderElector struct {
+	h    *Helper
+	name string
+	ttl  time.Duration
+
+	OnAcquired func(ctx context.Context, token int64)
+	OnLost     func()
+
+	mu   sync.Mutex
+	lock *Lock
+}
+
+func (h *Helper) NewLeaderElector(name string, ttl time.Duration) (*LeaderElector, error) {
+	if name == "" {
+		return nil, fmt.Errorf("election name is nil. value: name(%s)", name)
+	}
+
+	if ttl <= 0 {
+		ttl = h.Lease.TTL.Std()
+	}
+
+	err := validateTTL(ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LeaderElector{h: h, name: name, ttl: ttl}, nil
+}
+
+func (e *LeaderElector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.lock != nil
+}
+
+func (e *LeaderElector) Token() int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.lock == nil {
+		return 0
+	}
+
+	return e.lock.Token()
+}
+
+func (e *LeaderElector) setLock(l *Lock) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lock = l
+}
+
+func (e *LeaderElector) Run(ctx context.Context) error {
+	retry := e.h.renewInterval(e.ttl)
+	for {
+		l, err := e.h.Lock(ctx, e.name, e.ttl)
+		if err != nil && !errors.Is(err, ErrLockHeld) {
+			log.Errorf("failed to acquire leadership %s: %s", e.name, err.Error())
+		}
+
+		if err == nil {
+			e.lead(ctx, l)
+		}
+
+		err = sleepCtx(ctx, retry)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (e *LeaderElector) lead(ctx context.Context, l *Lock) {
+	e.setLock(l)
+	defer e.setLock(nil)
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if e.OnAcquired != nil {
+		go e.OnAcquired(leaderCtx, l.Token())
+	}
+
+	select {
+	case <-ctx.Done():
+		cancel()
+		err := l.Unlock(context.Background())
+		if err != nil {
+			log.Errorf("failed to release leadership %s: %s", e.name, err.Error())
+		}
+	case <-l.Lost():
+		cancel()
+	}
+
+	if e.OnLost != nil {
+		e.OnLost()
+	}
+}
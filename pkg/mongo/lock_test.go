@@ -0,0 +1,159 @@
+package mongo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/mongo"
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/mongo/mongotest"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	lockColl = "_locks"
+)
+
+func newLockHelper(t *testing.T) (*mongo.Helper, *mongotest.Fake) {
+	t.Helper()
+
+	return newHelper(t, mongo.LeaseDatabase(testDB), mongo.LeaseTTL(10*time.Second))
+}
+
+func expireLease(t *testing.T, f *mongotest.Fake, name string) {
+	t.Helper()
+
+	_, err := f.Collection(testDB, lockColl).UpdateOne(
+		context.Background(),
+		bson.M{"_id": name},
+		bson.M{"$set": bson.M{"expiresAt": time.Now().Add(-time.Second)}},
+	)
+	if err != nil {
+		t.Fatalf("failed to expire lease: %s", err.Error())
+	}
+}
+
+func TestLockValidation(t *testing.T) {
+	h, _ := newLockHelper(t)
+
+	tests := []struct {
+		name     string
+		lockName string
+		ttl      time.Duration
+	}{
+		{name: "empty name", ttl: time.Minute},
+		{name: "ttl below minimum", lockName: "job", ttl: 500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := h.Lock(context.Background(), tt.lockName, tt.ttl)
+			if err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
+
+func TestLockFencing(t *testing.T) {
+	ctx := context.Background()
+	h, _ := newLockHelper(t)
+
+	first, err := h.Lock(ctx, "job", 0)
+	if err != nil {
+		t.Fatalf("lock failed: %s", err.Error())
+	}
+	if first.Token() != 1 {
+		t.Errorf("expected token 1, got %d", first.Token())
+	}
+
+	_, err = h.Lock(ctx, "job", 0)
+	if !errors.Is(err, mongo.ErrLockHeld) {
+		t.Fatalf("expected ErrLockHeld, got %v", err)
+	}
+
+	err = first.Check(ctx)
+	if err != nil {
+		t.Fatalf("check failed: %s", err.Error())
+	}
+
+	err = first.Unlock(ctx)
+	if err != nil {
+		t.Fatalf("unlock failed: %s", err.Error())
+	}
+
+	second, err := h.Lock(ctx, "job", 0)
+	if err != nil {
+		t.Fatalf("lock after unlock failed: %s", err.Error())
+	}
+	defer second.Unlock(ctx)
+
+	if second.Token() <= first.Token() {
+		t.Errorf("expected a larger fencing token, got %d after %d", second.Token(), first.Token())
+	}
+}
+
+func TestLockExpiry(t *testing.T) {
+	ctx := context.Background()
+	h, f := newLockHelper(t)
+
+	first, err := h.Lock(ctx, "job", 0)
+	if err != nil {
+		t.Fatalf("lock failed: %s", err.Error())
+	}
+
+	expireLease(t, f, "job")
+
+	second, err := h.Lock(ctx, "job", 0)
+	if err != nil {
+		t.Fatalf("lock after expiry failed: %s", err.Error())
+	}
+	if second.Token() != first.Token()+1 {
+		t.Errorf("expected token %d, got %d", first.Token()+1, second.Token())
+	}
+
+	err = first.Check(ctx)
+	if !errors.Is(err, mongo.ErrLockLost) {
+		t.Fatalf("expected ErrLockLost, got %v", err)
+	}
+
+	select {
+	case <-first.Lost():
+	default:
+		t.Errorf("expected Lost to be closed")
+	}
+
+	err = first.Unlock(ctx)
+	if !errors.Is(err, mongo.ErrLockLost) {
+		t.Errorf("expected ErrLockLost on unlock, got %v", err)
+	}
+
+	err = second.Check(ctx)
+	if err != nil {
+		t.Errorf("stale unlock released the new owner: %v", err)
+	}
+
+	err = second.Unlock(ctx)
+	if err != nil {
+		t.Errorf("unlock failed: %s", err.Error())
+	}
+}
+
+func TestLockExpiredOwnerCheck(t *testing.T) {
+	ctx := context.Background()
+	h, f := newLockHelper(t)
+
+	l, err := h.Lock(ctx, "job", 0)
+	if err != nil {
+		t.Fatalf("lock failed: %s", err.Error())
+	}
+	defer l.Unlock(ctx)
+
+	expireLease(t, f, "job")
+
+	err = l.Check(ctx)
+	if !errors.Is(err, mongo.ErrLockLost) {
+		t.Errorf("expected ErrLockLost for an expired lease, got %v", err)
+	}
+}
@@ -0,0 +1,332 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	log "go-micro.dev/v5/logger"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	migrationLockID = "lock"
+)
+
+var (
+	ErrMigrationLocked = errors.New("migrations are locked by another runner")
+
+	migrations   = map[int]MigrationStep{}
+	migrationsMu sync.Mutex
+)
+
+type MigrationStep struct {
+	Version     int
+	Description string
+	Up          func(context.Context, *Helper) error
+}
+
+type MigrationStatus struct {
+	Version     int       `json:"version" bson:"version"`
+	Description string    `json:"description" bson:"description"`
+	Applied     bool      `json:"applied" bson:"-"`
+	AppliedAt   time.Time `json:"appliedAt" bson:"appliedAt"`
+}
+
+type Migrator struct {
+	h     *Helper
+	db    string
+	steps map[int]MigrationStep
+}
+
+func IndexStep(version int, description, db, coll string, indexes ...Index) MigrationStep {
+	return MigrationStep{
+		Version:     version,
+		Description: description,
+		Up: func(ctx context.Context, h *Helper) error {
+			return h.EnsureIndexes(ctx, db, coll, indexes...)
+		},
+	}
+}
+
+func ValidatorStep(version int, description, db, coll string, schema bson.M) MigrationStep {
+	return MigrationStep{
+		Version:     version,
+		Description: description,
+		Up: func(ctx context.Context, h *Helper) error {
+			return h.SetValidator(ctx, db, coll, schema)
+		},
+	}
+}
+
+func BackfillStep(version int, description string, fn func(context.Context, *Helper) error) MigrationStep {
+	return MigrationStep{
+		Version:     version,
+		Description: description,
+		Up:          fn,
+	}
+}
+
+func RegisterMigration(steps ...MigrationStep) error {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+
+	for _, s := range steps {
+		err := addStep(migrations, s)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func addStep(steps map[int]MigrationStep, s MigrationStep) error {
+	if s.Version <= 0 {
+		return fmt.Errorf("migration version must be positive. value: version(%d)", s.Version)
+	}
+
+	if s.Up == nil {
+		return fmt.Errorf("migration %d has no up function", s.Version)
+	}
+
+	if _, ok := steps[s.Version]; ok {
+		return fmt.Errorf("migration %d is already registered", s.Version)
+	}
+
+	steps[s.Version] = s
+	return nil
+}
+
+func genOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano())
+}
+
+func (h *Helper) NewMigrator(db string, steps ...MigrationStep) (*Migrator, error) {
+	if db == "" {
+		return nil, fmt.Errorf("db is nil. value: db(%s)", db)
+	}
+
+	m := &Migrator{
+		h:     h,
+		db:    db,
+		steps: map[int]MigrationStep{},
+	}
+
+	for _, s := range steps {
+		err := addStep(m.steps, s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func (h *Helper) Migrate(ctx context.Context, db string, dryRun bool) ([]MigrationStatus, error) {
+	migrationsMu.Lock()
+	steps := []MigrationStep{}
+	for _, s := range migrations {
+		steps = append(steps, s)
+	}
+	migrationsMu.Unlock()
+
+	m, err := h.NewMigrator(db, steps...)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Up(ctx, dryRun)
+}
+
+func (m *Migrator) Register(steps ...MigrationStep) error {
+	for _, s := range steps {
+		err := addStep(m.steps, s)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) coll() (CollClient, error) {
+	return m.h.NewCollCli(m.db, m.h.Migration.Collection)
+}
+
+func (m *Migrator) sortedSteps() []MigrationStep {
+	steps := []MigrationStep{}
+	for _, s := range m.steps {
+		steps = append(steps, s)
+	}
+
+	sort.Slice(steps, func(i, j int) bool {
+		return steps[i].Version < steps[j].Version
+	})
+
+	return steps
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]MigrationStatus, error) {
+	c, err := m.coll()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := m.h.withTimeout(ctx)
+	defer cancel()
+	cursor, err := c.Find(ctx, bson.M{"version": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []MigrationStatus{}
+	err = cursor.All(ctx, &statuses)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[int]MigrationStatus{}
+	for _, s := range statuses {
+		s.Applied = true
+		applied[s.Version] = s
+	}
+
+	return applied, nil
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []MigrationStatus{}
+	for _, s := range m.sortedSteps() {
+		status, ok := applied[s.Version]
+		if !ok {
+			status = MigrationStatus{Version: s.Version}
+		}
+
+		status.Description = s.Description
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+func (m *Migrator) Up(ctx context.Context, dryRun bool) ([]MigrationStatus, error) {
+	if dryRun {
+		return m.pending(ctx)
+	}
+
+	l, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.unlock(l)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-l.Lost():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	pending, err := m.pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []MigrationStatus{}
+	for _, status := range pending {
+		err = l.Check(ctx)
+		if err != nil {
+			return done, fmt.Errorf("migration lock lost before migration %d: %w", status.Version, err)
+		}
+
+		log.Infof("applying mongo migration %d: %s", status.Version, status.Description)
+		err = m.steps[status.Version].Up(ctx, m.h)
+		if err != nil {
+			return done, fmt.Errorf("failed to apply migration %d: %w", status.Version, err)
+		}
+
+		err = l.Check(ctx)
+		if err != nil {
+			return done, fmt.Errorf("migration lock lost while applying migration %d: %w", status.Version, err)
+		}
+
+		status.Applied = true
+		status.AppliedAt = time.Now().UTC()
+		err = m.record(ctx, status)
+		if err != nil {
+			return done, err
+		}
+
+		done = append(done, status)
+	}
+
+	return done, nil
+}
+
+func (m *Migrator) pending(ctx context.Context) ([]MigrationStatus, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []MigrationStatus{}
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, s)
+		}
+	}
+
+	return pending, nil
+}
+
+func (m *Migrator) record(ctx context.Context, status MigrationStatus) error {
+	c, err := m.coll()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := m.h.withTimeout(ctx)
+	defer cancel()
+	_, err = c.UpdateOne(
+		ctx,
+		bson.M{"_id": status.Version},
+		bson.M{"$set": status},
+		CreateRecordIfNotExist,
+	)
+
+	return err
+}
+
+func (m *Migrator) lock(ctx context.Context) (*Lock, error) {
+	l, err := m.h.lockIn(ctx, m.coll, migrationLockID, m.h.Migration.LeaseTTL.Std())
+	if errors.Is(err, ErrLockHeld) {
+		return nil, ErrMigrationLocked
+	}
+
+	return l, err
+}
+
+func (m *Migrator) unlock(l *Lock) {
+	err := l.Unlock(context.Background())
+	if err != nil && !errors.Is(err, ErrLockLost) {
+		log.Errorf("failed to release migration lock: %s", err.Error())
+	}
+}
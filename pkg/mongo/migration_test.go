@@ -0,0 +1,182 @@
+package mongo_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	migrationColl = "_migrations"
+)
+
+func versions(statuses []mongo.MigrationStatus) []int {
+	v := []int{}
+	for _, s := range statuses {
+		v = append(v, s.Version)
+	}
+
+	return v
+}
+
+func TestMigratorUp(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	tests := []struct {
+		name        string
+		applied     []int
+		failAt      int
+		dryRun      bool
+		wantDone    []int
+		wantRan     []int
+		wantApplied []int
+		wantErr     error
+	}{
+		{
+			name:        "applies pending in order",
+			wantDone:    []int{1, 2, 3},
+			wantRan:     []int{1, 2, 3},
+			wantApplied: []int{1, 2, 3},
+		},
+		{
+			name:        "skips applied",
+			applied:     []int{1, 2},
+			wantDone:    []int{3},
+			wantRan:     []int{3},
+			wantApplied: []int{1, 2, 3},
+		},
+		{
+			name:        "dry run only lists pending",
+			applied:     []int{1},
+			dryRun:      true,
+			wantDone:    []int{2, 3},
+			wantRan:     []int{},
+			wantApplied: []int{1},
+		},
+		{
+			name:        "stops at the first failure",
+			failAt:      2,
+			wantDone:    []int{1},
+			wantRan:     []int{1, 2},
+			wantApplied: []int{1},
+			wantErr:     errBoom,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h, f := newHelper(t)
+
+			for _, v := range tt.applied {
+				err := f.Seed(testDB, migrationColl, bson.M{"_id": v, "version": v, "appliedAt": time.Now()})
+				if err != nil {
+					t.Fatalf("seed failed: %s", err.Error())
+				}
+			}
+
+			ran := []int{}
+			step := func(v int) mongo.MigrationStep {
+				return mongo.BackfillStep(v, "step", func(context.Context, *mongo.Helper) error {
+					ran = append(ran, v)
+					if v == tt.failAt {
+						return errBoom
+					}
+					return nil
+				})
+			}
+
+			m, err := h.NewMigrator(testDB, step(3), step(1), step(2))
+			if err != nil {
+				t.Fatalf("failed to create migrator: %s", err.Error())
+			}
+
+			done, err := m.Up(ctx, tt.dryRun)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got := versions(done); !reflect.DeepEqual(got, tt.wantDone) {
+				t.Errorf("expected done %v, got %v", tt.wantDone, got)
+			}
+			if !reflect.DeepEqual(ran, tt.wantRan) {
+				t.Errorf("expected ran %v, got %v", tt.wantRan, ran)
+			}
+
+			statuses, err := m.Status(ctx)
+			if err != nil {
+				t.Fatalf("status failed: %s", err.Error())
+			}
+			applied := []int{}
+			for _, s := range statuses {
+				if s.Applied {
+					applied = append(applied, s.Version)
+				}
+			}
+			if !reflect.DeepEqual(applied, tt.wantApplied) {
+				t.Errorf("expected applied %v, got %v", tt.wantApplied, applied)
+			}
+		})
+	}
+}
+
+func TestMigratorLease(t *testing.T) {
+	ctx := context.Background()
+	h, f := newHelper(t)
+
+	err := f.Seed(testDB, migrationColl, bson.M{
+		"_id":       "lock",
+		"owner":     "other-runner",
+		"token":     int64(1),
+		"expiresAt": time.Now().Add(time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("seed failed: %s", err.Error())
+	}
+
+	ran := false
+	m, err := h.NewMigrator(testDB, mongo.BackfillStep(1, "step", func(context.Context, *mongo.Helper) error {
+		ran = true
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("failed to create migrator: %s", err.Error())
+	}
+
+	_, err = m.Up(ctx, false)
+	if !errors.Is(err, mongo.ErrMigrationLocked) {
+		t.Fatalf("expected ErrMigrationLocked, got %v", err)
+	}
+	if ran {
+		t.Fatalf("migration ran while another runner held the lease")
+	}
+
+	pending, err := m.Up(ctx, true)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("dry run should ignore the lease. got %v, %v", pending, err)
+	}
+
+	_, err = f.Collection(testDB, migrationColl).UpdateOne(ctx, bson.M{"_id": "lock"}, bson.M{"$set": bson.M{"expiresAt": time.Now().Add(-time.Second)}})
+	if err != nil {
+		t.Fatalf("failed to expire lease: %s", err.Error())
+	}
+
+	done, err := m.Up(ctx, false)
+	if err != nil {
+		t.Fatalf("up failed after the lease expired: %s", err.Error())
+	}
+	if !ran || len(done) != 1 {
+		t.Errorf("expected migration to run once the lease expired. got %v", done)
+	}
+
+	lock := f.Docs(testDB, migrationColl)
+	for _, d := range lock {
+		if d["_id"] == "lock" && d["owner"] != "" {
+			t.Errorf("lease was not released: %v", d)
+		}
+	}
+}
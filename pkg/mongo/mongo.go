@@ -2,14 +2,17 @@ package mongo
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"os"
 	"sync"
-	"time"
 
 	log "go-micro.dev/v5/logger"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 var (
@@ -22,15 +25,20 @@ var (
 type Client interface {
 	Database(string, ...*options.DatabaseOptions) *mongo.Database
 	StartSession(...*options.SessionOptions) (mongo.Session, error)
+	Ping(context.Context, *readpref.ReadPref) error
 	Disconnect(context.Context) error
 }
 
 type DBClient interface {
 	Collection(string, ...*options.CollectionOptions) *mongo.Collection
 	ListCollectionNames(context.Context, interface{}, ...*options.ListCollectionsOptions) ([]string, error)
+	RunCommand(context.Context, interface{}, ...*options.RunCmdOptions) *mongo.SingleResult
 }
 
 type TxnClient interface {
+	StartTransaction(...*options.TransactionOptions) error
+	AbortTransaction(context.Context) error
+	CommitTransaction(context.Context) error
 	WithTransaction(context.Context, func(mongo.SessionContext) (interface{}, error), ...*options.TransactionOptions) (interface{}, error)
 	EndSession(context.Context)
 }
@@ -41,25 +49,84 @@ type CollClient interface {
 	FindOneAndUpdate(context.Context, interface{}, interface{}, ...*options.FindOneAndUpdateOptions) *mongo.SingleResult
 	FindOneAndDelete(context.Context, interface{}, ...*options.FindOneAndDeleteOptions) *mongo.SingleResult
 	InsertOne(context.Context, interface{}, ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
+	InsertMany(context.Context, []interface{}, ...*options.InsertManyOptions) (*mongo.InsertManyResult, error)
+	BulkWrite(context.Context, []mongo.WriteModel, ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error)
 	DeleteOne(context.Context, interface{}, ...*options.DeleteOptions) (*mongo.DeleteResult, error)
 	DeleteMany(context.Context, interface{}, ...*options.DeleteOptions) (*mongo.DeleteResult, error)
 	UpdateOne(context.Context, interface{}, interface{}, ...*options.UpdateOptions) (*mongo.UpdateResult, error)
 	UpdateMany(context.Context, interface{}, interface{}, ...*options.UpdateOptions) (*mongo.UpdateResult, error)
 	CountDocuments(context.Context, interface{}, ...*options.CountOptions) (int64, error)
+	Aggregate(context.Context, interface{}, ...*options.AggregateOptions) (*mongo.Cursor, error)
+	Watch(context.Context, interface{}, ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error)
 }
 
 type CursorClient interface {
 	All(context.Context, interface{}) error
 	Next(context.Context) bool
+	Decode(interface{}) error
+	Err() error
+	Close(context.Context) error
+	SetBatchSize(int32)
+}
+
+type Backend interface {
+	Database(string) DBClient
+	Collection(string, string) CollClient
+	StartSession() (TxnClient, error)
+	Ping(context.Context) error
+	Disconnect(context.Context) error
 }
 
 type Helper struct {
 	Client
+	Backend Backend
 	Options
+
+	inflight      inflight
+	monitorMu     sync.Mutex
+	monitorCancel context.CancelFunc
+	encryption    encryption
 }
 
 func initOptions(opts []Option) *Options {
-	options := &Options{Auth: Auth{Enable: true}}
+	options := &Options{
+		Auth:    Auth{Enable: true},
+		Timeout: defaultTimeout,
+		Txn: Txn{
+			MaxRetries: defaultTxnMaxRetries,
+			Backoff:    defaultTxnBackoff,
+			MaxBackoff: defaultTxnMaxBackoff,
+		},
+		Watcher: Watcher{
+			TokenCollection: defaultWatchTokenCollection,
+			Concurrency:     defaultWatchConcurrency,
+			Backoff:         defaultWatchBackoff,
+			MaxBackoff:      defaultWatchMaxBackoff,
+		},
+		Migration: Migration{
+			Collection: defaultMigrationCollection,
+			LeaseTTL:   defaultMigrationLeaseTTL,
+		},
+		BulkWrite: BulkWrite{
+			BatchSize: defaultBulkBatchSize,
+			Ordered:   defaultBulkOrdered,
+		},
+		Health: Health{
+			Interval: defaultHealthInterval,
+		},
+		Lease: Lease{
+			Collection: defaultLeaseCollection,
+			TTL:        defaultLeaseTTL,
+		},
+		Audit: Audit{
+			Fields: AuditFields{
+				CreatedAt: defaultAuditCreatedAt,
+				UpdatedAt: defaultAuditUpdatedAt,
+				DeletedAt: defaultAuditDeletedAt,
+				CreatedBy: defaultAuditCreatedBy,
+			},
+		},
+	}
 	for _, o := range opts {
 		o(options)
 	}
@@ -76,9 +143,27 @@ func NewHelper(opts ...Option) (*Helper, error) {
 		return nil, err
 	}
 
+	if h.Health.PingOnConnect {
+		err = h.Ping(context.Background())
+		if err != nil {
+			log.Errorf("err of ping mongo: %s", err.Error())
+			h.Close()
+			return nil, err
+		}
+	}
+
 	return h, nil
 }
 
+func NewHelperWithBackend(backend Backend, opts ...Option) (*Helper, error) {
+	if backend == nil {
+		return nil, fmt.Errorf("backend is nil")
+	}
+
+	initedOpts := initOptions(opts)
+	return &Helper{Backend: backend, Options: *initedOpts}, nil
+}
+
 func NewGlobalHelper(opts ...Option) error {
 	var err error
 	once.Do(func() {
@@ -95,29 +180,153 @@ func NewGlobalHelper(opts ...Option) error {
 }
 
 func (h *Helper) SetMongoClient() error {
+	opt, err := h.genClientOptions()
+	if err != nil {
+		log.Errorf("err of mongo client options: %s", err.Error())
+		return err
+	}
+
+	mongoCli, err := mongo.Connect(context.Background(), opt)
+	if err != nil {
+		log.Errorf("err of connect mongo: %s", err.Error())
+		return err
+	}
+
+	h.Client = mongoCli
+	return nil
+}
+
+func (h *Helper) genClientOptions() (*options.ClientOptions, error) {
 	opt := options.Client()
 	opt.ApplyURI(h.Uri)
 
 	if h.Auth.Enable {
-		opt.Auth = &options.Credential{
-			AuthSource: h.Auth.Source,
-			Username:   h.Auth.Username,
-			Password:   h.Auth.Password,
-		}
+		opt.Auth = h.genCredential()
 	}
 
 	if h.ReplicaSet != "" {
 		opt.ReplicaSet = &h.ReplicaSet
 	}
 
-	mongoCli, err := mongo.Connect(context.Background(), opt)
-	if err != nil {
-		log.Errorf("err of connect mongo: %s", err.Error())
-		return err
+	switch h.Connect {
+	case "", ConnectAutomatic:
+	case ConnectDirect:
+		opt.SetDirect(true)
+	case ConnectReplicaSet:
+		if h.ReplicaSet == "" && opt.ReplicaSet == nil {
+			return nil, fmt.Errorf("replicaSet is required when connect is %s", ConnectReplicaSet)
+		}
+		opt.SetDirect(false)
+	default:
+		return nil, fmt.Errorf(
+			"unknown connect mode. value: connect(%s); expected %s, %s or %s",
+			h.Connect,
+			ConnectAutomatic,
+			ConnectDirect,
+			ConnectReplicaSet,
+		)
 	}
 
-	h.Client = mongoCli
-	return nil
+	if h.Tls.Enable {
+		tlsConf, err := h.genTlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opt.SetTLSConfig(tlsConf)
+	}
+
+	if h.ReadPreference != "" {
+		mode, err := readpref.ModeFromString(h.ReadPreference)
+		if err != nil {
+			return nil, err
+		}
+
+		rp, err := readpref.New(mode)
+		if err != nil {
+			return nil, err
+		}
+		opt.SetReadPreference(rp)
+	}
+
+	if h.Pool.MaxSize > 0 {
+		opt.SetMaxPoolSize(h.Pool.MaxSize)
+	}
+	if h.Pool.MinSize > 0 {
+		opt.SetMinPoolSize(h.Pool.MinSize)
+	}
+	if h.Pool.MaxIdleTime > 0 {
+		opt.SetMaxConnIdleTime(h.Pool.MaxIdleTime.Std())
+	}
+	if h.ConnectTimeout > 0 {
+		opt.SetConnectTimeout(h.ConnectTimeout.Std())
+	}
+	if h.ServerSelectionTimeout > 0 {
+		opt.SetServerSelectionTimeout(h.ServerSelectionTimeout.Std())
+	}
+	if h.SocketTimeout > 0 {
+		opt.SetSocketTimeout(h.SocketTimeout.Std())
+	}
+
+	if h.Monitoring.enabled() {
+		opt.SetMonitor(h.newCommandMonitor())
+		opt.SetPoolMonitor(h.newPoolMonitor())
+	}
+
+	return opt, opt.Validate()
+}
+
+func (h *Helper) genCredential() *options.Credential {
+	cred := &options.Credential{
+		AuthMechanism: h.Auth.Mechanism,
+		AuthSource:    h.Auth.Source,
+		Username:      h.Auth.Username,
+		Password:      h.Auth.Password,
+	}
+
+	if h.Auth.Mechanism == AuthMechanismX509 {
+		cred.Password = ""
+		if cred.AuthSource == "" {
+			cred.AuthSource = "$external"
+		}
+	}
+
+	return cred
+}
+
+func (h *Helper) genTlsConfig() (*tls.Config, error) {
+	conf := &tls.Config{InsecureSkipVerify: h.Tls.InsecureSkipVerify}
+
+	if h.Tls.CaFile != "" {
+		ca, err := os.ReadFile(h.Tls.CaFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no valid certificates found in ca file %s", h.Tls.CaFile)
+		}
+		conf.RootCAs = pool
+	}
+
+	if h.Tls.CertFile != "" {
+		keyFile := h.Tls.KeyFile
+		if keyFile == "" {
+			keyFile = h.Tls.CertFile
+		}
+
+		cert, err := tls.LoadX509KeyPair(h.Tls.CertFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	if h.Auth.Enable && h.Auth.Mechanism == AuthMechanismX509 && len(conf.Certificates) == 0 {
+		return nil, fmt.Errorf("client certificate is required for %s", AuthMechanismX509)
+	}
+
+	return conf, nil
 }
 
 func GetGlobalHelper() *Helper {
@@ -132,6 +341,10 @@ func (h *Helper) NewDBCli(db string) (DBClient, error) {
 		)
 	}
 
+	if h.Backend != nil {
+		return h.Backend.Database(db), nil
+	}
+
 	return h.Client.Database(db), nil
 }
 
@@ -144,11 +357,19 @@ func (h *Helper) NewCollCli(db, coll string) (CollClient, error) {
 		)
 	}
 
+	if h.Backend != nil {
+		return h.Backend.Collection(db, coll), nil
+	}
+
 	dbCli := h.Client.Database(db)
 	return dbCli.Collection(coll), nil
 }
 
 func (h *Helper) NewTxnCli() (TxnClient, error) {
+	if h.Backend != nil {
+		return h.Backend.StartSession()
+	}
+
 	s, err := h.Client.StartSession()
 	if err != nil {
 		return nil, err
@@ -157,13 +378,40 @@ func (h *Helper) NewTxnCli() (TxnClient, error) {
 	return s, nil
 }
 
+func (h *Helper) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	done := h.inflight.begin()
+
+	var cancel context.CancelFunc
+	if _, ok := ctx.Deadline(); ok || h.Timeout <= 0 {
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout.Std())
+	}
+
+	return ctx, func() {
+		cancel()
+		done()
+	}
+}
+
+// GetQueryCursor returns documents as stored, secure fields stay encrypted.
+// Use Decrypt on each document, or a Repository, to read them in plain.
 func (h *Helper) GetQueryCursor(db, coll string, query bson.M, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	return h.GetQueryCursorCtx(context.Background(), db, coll, query, opts...)
+}
+
+func (h *Helper) GetQueryCursorCtx(ctx context.Context, db, coll string, query bson.M, opts ...*options.FindOptions) (*mongo.Cursor, error) {
 	c, err := h.NewCollCli(db, coll)
 	if err != nil {
 		return nil, err
 	}
 
-	cursor, err := c.Find(context.Background(), query, opts...)
+	filter, err := h.scopeFilter(ctx, db, coll, query)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := c.Find(ctx, filter, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -172,27 +420,45 @@ func (h *Helper) GetQueryCursor(db, coll string, query bson.M, opts ...*options.
 }
 
 func (h *Helper) Get(db, coll string, filter bson.M) (*mongo.SingleResult, error) {
+	return h.GetCtx(context.Background(), db, coll, filter)
+}
+
+func (h *Helper) GetCtx(ctx context.Context, db, coll string, filter bson.M) (*mongo.SingleResult, error) {
 	c, err := h.NewCollCli(db, coll)
 	if err != nil {
 		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	scoped, err := h.scopeFilter(ctx, db, coll, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := h.withTimeout(ctx)
 	defer cancel()
 
-	result := c.FindOne(ctx, filter)
-	return result, nil
+	result := c.FindOne(ctx, scoped)
+	return h.decryptResult(db, coll, result), nil
 }
 
 func (h *Helper) GetCount(db, coll string, filter bson.M) (int64, error) {
+	return h.GetCountCtx(context.Background(), db, coll, filter)
+}
+
+func (h *Helper) GetCountCtx(ctx context.Context, db, coll string, filter bson.M) (int64, error) {
 	c, err := h.NewCollCli(db, coll)
 	if err != nil {
 		return 0, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	count, err := c.CountDocuments(ctx, filter)
+	scoped, err := h.scopeFilter(ctx, db, coll, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := h.withTimeout(ctx)
 	defer cancel()
+	count, err := c.CountDocuments(ctx, scoped)
 	if err != nil {
 		return 0, err
 	}
@@ -201,12 +467,26 @@ func (h *Helper) GetCount(db, coll string, filter bson.M) (int64, error) {
 }
 
 func (h *Helper) Insert(db, coll string, data interface{}) error {
+	return h.InsertCtx(context.Background(), db, coll, data)
+}
+
+func (h *Helper) InsertCtx(ctx context.Context, db, coll string, data interface{}) error {
 	c, err := h.NewCollCli(db, coll)
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	data, err = h.encrypt(db, coll, data)
+	if err != nil {
+		return err
+	}
+
+	data, err = h.stampInsert(ctx, db, coll, data)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := h.withTimeout(ctx)
 	defer cancel()
 	_, err = c.InsertOne(ctx, data)
 	if err != nil {
@@ -216,13 +496,57 @@ func (h *Helper) Insert(db, coll string, data interface{}) error {
 	return nil
 }
 
+func (h *Helper) InsertMany(db, coll string, data []interface{}) error {
+	return h.InsertManyCtx(context.Background(), db, coll, data)
+}
+
+func (h *Helper) InsertManyCtx(ctx context.Context, db, coll string, data []interface{}) error {
+	c, err := h.NewCollCli(db, coll)
+	if err != nil {
+		return err
+	}
+
+	data, err = h.encryptMany(db, coll, data)
+	if err != nil {
+		return err
+	}
+
+	data, err = h.stampInsertMany(ctx, db, coll, data)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := h.withTimeout(ctx)
+	defer cancel()
+	_, err = c.InsertMany(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (h *Helper) UpdateOne(db, coll string, filter interface{}, data interface{}, opts ...*options.UpdateOptions) error {
+	return h.UpdateOneCtx(context.Background(), db, coll, filter, data, opts...)
+}
+
+func (h *Helper) UpdateOneCtx(ctx context.Context, db, coll string, filter interface{}, data interface{}, opts ...*options.UpdateOptions) error {
 	c, err := h.NewCollCli(db, coll)
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	data, err = h.encryptUpdate(db, coll, data)
+	if err != nil {
+		return err
+	}
+
+	data, err = h.stampUpdate(ctx, db, coll, data)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := h.withTimeout(ctx)
 	defer cancel()
 	_, err = c.UpdateOne(ctx, filter, data, opts...)
 	if err != nil {
@@ -233,12 +557,26 @@ func (h *Helper) UpdateOne(db, coll string, filter interface{}, data interface{}
 }
 
 func (h *Helper) UpdateMany(db, coll string, filter interface{}, data interface{}) error {
+	return h.UpdateManyCtx(context.Background(), db, coll, filter, data)
+}
+
+func (h *Helper) UpdateManyCtx(ctx context.Context, db, coll string, filter interface{}, data interface{}) error {
 	c, err := h.NewCollCli(db, coll)
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	data, err = h.encryptUpdate(db, coll, data)
+	if err != nil {
+		return err
+	}
+
+	data, err = h.stampUpdate(ctx, db, coll, data)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := h.withTimeout(ctx)
 	defer cancel()
 	_, err = c.UpdateMany(ctx, filter, data)
 	if err != nil {
@@ -249,13 +587,27 @@ func (h *Helper) UpdateMany(db, coll string, filter interface{}, data interface{
 }
 
 func (h *Helper) DeleteOne(db, coll string, filter interface{}) error {
+	return h.DeleteOneCtx(context.Background(), db, coll, filter)
+}
+
+func (h *Helper) DeleteOneCtx(ctx context.Context, db, coll string, filter interface{}) error {
 	c, err := h.NewCollCli(db, coll)
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := h.withTimeout(ctx)
 	defer cancel()
+	if h.softDelete(db, coll) {
+		filter, err = h.scopeFilter(ctx, db, coll, filter)
+		if err != nil {
+			return err
+		}
+
+		_, err = c.UpdateOne(ctx, filter, h.softDeleteUpdate(db, coll))
+		return err
+	}
+
 	_, err = c.DeleteOne(ctx, filter)
 	if err != nil {
 		return err
@@ -265,13 +617,27 @@ func (h *Helper) DeleteOne(db, coll string, filter interface{}) error {
 }
 
 func (h *Helper) DeleteAll(db, coll string, filter interface{}) error {
+	return h.DeleteAllCtx(context.Background(), db, coll, filter)
+}
+
+func (h *Helper) DeleteAllCtx(ctx context.Context, db, coll string, filter interface{}) error {
 	c, err := h.NewCollCli(db, coll)
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := h.withTimeout(ctx)
 	defer cancel()
+	if h.softDelete(db, coll) {
+		filter, err = h.scopeFilter(ctx, db, coll, filter)
+		if err != nil {
+			return err
+		}
+
+		_, err = c.UpdateMany(ctx, filter, h.softDeleteUpdate(db, coll))
+		return err
+	}
+
 	_, err = c.DeleteMany(ctx, filter)
 	if err != nil {
 		return err
@@ -281,12 +647,16 @@ func (h *Helper) DeleteAll(db, coll string, filter interface{}) error {
 }
 
 func (h *Helper) GetAllCollections(db string) ([]string, error) {
+	return h.GetAllCollectionsCtx(context.Background(), db)
+}
+
+func (h *Helper) GetAllCollectionsCtx(ctx context.Context, db string) ([]string, error) {
 	dbCli, err := h.NewDBCli(db)
 	if err != nil {
 		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := h.withTimeout(ctx)
 	defer cancel()
 	collections, err := dbCli.ListCollectionNames(ctx, bson.M{})
 	if err != nil {
@@ -297,7 +667,7 @@ func (h *Helper) GetAllCollections(db string) ([]string, error) {
 }
 
 func (h *Helper) Close() {
-	err := h.Client.Disconnect(context.Background())
+	err := h.CloseCtx(context.Background())
 	if err != nil {
 		log.Errorf("failed to close mongo connection: %s", err.Error())
 	}
@@ -0,0 +1,649 @@
+package mongotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type collClient struct {
+	f    *Fake
+	db   string
+	coll string
+	sess *session
+}
+
+func (c *collClient) in(ctx context.Context) *collClient {
+	s, ok := driver.SessionFromContext(ctx).(*session)
+	if !ok || s.f != c.f {
+		return c
+	}
+
+	scoped := *c
+	scoped.sess = s
+	return &scoped
+}
+
+func (c *collClient) docs() []bson.M {
+	if c.sess != nil && c.sess.txn != nil {
+		return c.sess.txn.coll(c.f, c.db, c.coll)
+	}
+
+	return c.f.coll(c.db, c.coll)
+}
+
+func (c *collClient) setDocs(docs []bson.M) {
+	if c.sess != nil && c.sess.txn != nil {
+		c.sess.txn.setColl(c.f, c.db, c.coll, docs)
+		return
+	}
+
+	c.f.setColl(c.db, c.coll, docs)
+}
+
+func toDocs(docs []bson.M) []interface{} {
+	out := make([]interface{}, len(docs))
+	for i, d := range docs {
+		out[i] = d
+	}
+
+	return out
+}
+
+func noDocument(err error) *driver.SingleResult {
+	if err == nil {
+		err = driver.ErrNoDocuments
+	}
+
+	return driver.NewSingleResultFromDocument(bson.M{}, err, nil)
+}
+
+func (c *collClient) find(filter interface{}) ([]int, error) {
+	f, err := normalize(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []int{}
+	for i, doc := range c.docs() {
+		ok, err := match(doc, f)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, i)
+		}
+	}
+
+	return matched, nil
+}
+
+func (c *collClient) query(filter, sort interface{}, skip, limit *int64) ([]bson.M, error) {
+	idx, err := c.find(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := []bson.M{}
+	for _, i := range idx {
+		docs = append(docs, clone(c.docs()[i]))
+	}
+
+	err = sortDocs(docs, sort)
+	if err != nil {
+		return nil, err
+	}
+
+	if skip != nil && *skip > 0 {
+		if *skip >= int64(len(docs)) {
+			return []bson.M{}, nil
+		}
+		docs = docs[*skip:]
+	}
+
+	if limit != nil && *limit != 0 {
+		n := *limit
+		if n < 0 {
+			n = -n
+		}
+		if n < int64(len(docs)) {
+			docs = docs[:n]
+		}
+	}
+
+	return docs, nil
+}
+
+func (c *collClient) indexOf(doc bson.M) int {
+	for i, d := range c.docs() {
+		if equal(d["_id"], doc["_id"]) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (c *collClient) insert(doc interface{}) (interface{}, error) {
+	d, err := normalize(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := d["_id"]; !ok {
+		d["_id"] = primitive.NewObjectID()
+	}
+
+	if c.indexOf(d) >= 0 {
+		return nil, DuplicateKeyError(fmt.Sprintf("{ _id: %v }", d["_id"]))
+	}
+
+	c.setDocs(append(c.docs(), d))
+	return d["_id"], nil
+}
+
+func (c *collClient) update(filter, update interface{}, upsert, many bool) (*driver.UpdateResult, bson.M, bson.M, error) {
+	f, err := normalize(filter)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	u, err := normalize(update)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	idx, err := c.find(f)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	result := &driver.UpdateResult{}
+	if len(idx) == 0 {
+		if !upsert {
+			return result, nil, nil, nil
+		}
+
+		doc, err := upsertDoc(f, u)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		id, err := c.insert(doc)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		result.UpsertedCount = 1
+		result.UpsertedID = id
+		docs := c.docs()
+		return result, nil, clone(docs[len(docs)-1]), nil
+	}
+
+	if !many {
+		idx = idx[:1]
+	}
+
+	var before, after bson.M
+	docs := c.docs()
+	for _, i := range idx {
+		doc := clone(docs[i])
+		before = clone(doc)
+		err = applyUpdate(doc, u, false)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		result.MatchedCount++
+		if !reflect.DeepEqual(before, doc) {
+			result.ModifiedCount++
+		}
+
+		docs[i] = doc
+		after = clone(doc)
+	}
+	c.setDocs(docs)
+
+	return result, before, after, nil
+}
+
+func (c *collClient) delete(filter interface{}, many bool) (int64, bson.M, error) {
+	idx, err := c.find(filter)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if len(idx) == 0 {
+		return 0, nil, nil
+	}
+
+	if !many {
+		idx = idx[:1]
+	}
+
+	remove := map[int]bool{}
+	for _, i := range idx {
+		remove[i] = true
+	}
+
+	docs := c.docs()
+	first := clone(docs[idx[0]])
+	kept := []bson.M{}
+	for i, d := range docs {
+		if !remove[i] {
+			kept = append(kept, d)
+		}
+	}
+
+	c.setDocs(kept)
+	return int64(len(idx)), first, nil
+}
+
+func (c *collClient) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*driver.Cursor, error) {
+	err := c.f.fault(ctx, "Find", c.db, c.coll)
+	if err != nil {
+		return nil, err
+	}
+
+	c.f.mu.Lock()
+	c = c.in(ctx)
+	defer c.f.mu.Unlock()
+
+	o := options.MergeFindOptions(opts...)
+	docs, err := c.query(filter, o.Sort, o.Skip, o.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range docs {
+		docs[i], err = project(docs[i], o.Projection)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return driver.NewCursorFromDocuments(toDocs(docs), nil, nil)
+}
+
+func (c *collClient) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *driver.SingleResult {
+	err := c.f.fault(ctx, "FindOne", c.db, c.coll)
+	if err != nil {
+		return noDocument(err)
+	}
+
+	c.f.mu.Lock()
+	c = c.in(ctx)
+	defer c.f.mu.Unlock()
+
+	o := options.MergeFindOneOptions(opts...)
+	limit := int64(1)
+	docs, err := c.query(filter, o.Sort, o.Skip, &limit)
+	if err != nil {
+		return noDocument(err)
+	}
+
+	if len(docs) == 0 {
+		return noDocument(nil)
+	}
+
+	doc, err := project(docs[0], o.Projection)
+	if err != nil {
+		return noDocument(err)
+	}
+
+	return driver.NewSingleResultFromDocument(doc, nil, nil)
+}
+
+func (c *collClient) FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) *driver.SingleResult {
+	err := c.f.fault(ctx, "FindOneAndUpdate", c.db, c.coll)
+	if err != nil {
+		return noDocument(err)
+	}
+
+	c.f.mu.Lock()
+	c = c.in(ctx)
+	defer c.f.mu.Unlock()
+
+	o := options.MergeFindOneAndUpdateOptions(opts...)
+	upsert := o.Upsert != nil && *o.Upsert
+	if o.Sort != nil {
+		limit := int64(1)
+		docs, err := c.query(filter, o.Sort, nil, &limit)
+		if err != nil {
+			return noDocument(err)
+		}
+		if len(docs) > 0 {
+			filter = bson.M{"_id": docs[0]["_id"]}
+		}
+	}
+
+	_, before, after, err := c.update(filter, update, upsert, false)
+	if err != nil {
+		return noDocument(err)
+	}
+
+	doc := before
+	if o.ReturnDocument != nil && *o.ReturnDocument == options.After {
+		doc = after
+	}
+	if doc == nil {
+		return noDocument(nil)
+	}
+
+	doc, err = project(doc, o.Projection)
+	if err != nil {
+		return noDocument(err)
+	}
+
+	return driver.NewSingleResultFromDocument(doc, nil, nil)
+}
+
+func (c *collClient) FindOneAndDelete(ctx context.Context, filter interface{}, opts ...*options.FindOneAndDeleteOptions) *driver.SingleResult {
+	err := c.f.fault(ctx, "FindOneAndDelete", c.db, c.coll)
+	if err != nil {
+		return noDocument(err)
+	}
+
+	c.f.mu.Lock()
+	c = c.in(ctx)
+	defer c.f.mu.Unlock()
+
+	o := options.MergeFindOneAndDeleteOptions(opts...)
+	if o.Sort != nil {
+		limit := int64(1)
+		docs, err := c.query(filter, o.Sort, nil, &limit)
+		if err != nil {
+			return noDocument(err)
+		}
+		if len(docs) == 0 {
+			return noDocument(nil)
+		}
+		filter = bson.M{"_id": docs[0]["_id"]}
+	}
+
+	n, doc, err := c.delete(filter, false)
+	if err != nil {
+		return noDocument(err)
+	}
+	if n == 0 {
+		return noDocument(nil)
+	}
+
+	return driver.NewSingleResultFromDocument(doc, nil, nil)
+}
+
+func (c *collClient) InsertOne(ctx context.Context, doc interface{}, _ ...*options.InsertOneOptions) (*driver.InsertOneResult, error) {
+	err := c.f.fault(ctx, "InsertOne", c.db, c.coll)
+	if err != nil {
+		return nil, err
+	}
+
+	c.f.mu.Lock()
+	c = c.in(ctx)
+	defer c.f.mu.Unlock()
+
+	id, err := c.insert(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &driver.InsertOneResult{InsertedID: id}, nil
+}
+
+func (c *collClient) InsertMany(ctx context.Context, docs []interface{}, opts ...*options.InsertManyOptions) (*driver.InsertManyResult, error) {
+	err := c.f.fault(ctx, "InsertMany", c.db, c.coll)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(docs) == 0 {
+		return nil, driver.ErrEmptySlice
+	}
+
+	c.f.mu.Lock()
+	c = c.in(ctx)
+	defer c.f.mu.Unlock()
+
+	o := options.MergeInsertManyOptions(opts...)
+	ordered := o.Ordered == nil || *o.Ordered
+
+	result := &driver.InsertManyResult{}
+	writeErrs := driver.BulkWriteException{}
+	for i, doc := range docs {
+		id, err := c.insert(doc)
+		if err != nil {
+			writeErrs.WriteErrors = append(writeErrs.WriteErrors, bulkWriteError(i, err))
+			if ordered {
+				break
+			}
+			continue
+		}
+
+		result.InsertedIDs = append(result.InsertedIDs, id)
+	}
+
+	if len(writeErrs.WriteErrors) > 0 {
+		return result, writeErrs
+	}
+
+	return result, nil
+}
+
+func (c *collClient) DeleteOne(ctx context.Context, filter interface{}, _ ...*options.DeleteOptions) (*driver.DeleteResult, error) {
+	return c.deleteOp(ctx, "DeleteOne", filter, false)
+}
+
+func (c *collClient) DeleteMany(ctx context.Context, filter interface{}, _ ...*options.DeleteOptions) (*driver.DeleteResult, error) {
+	return c.deleteOp(ctx, "DeleteMany", filter, true)
+}
+
+func (c *collClient) deleteOp(ctx context.Context, op string, filter interface{}, many bool) (*driver.DeleteResult, error) {
+	err := c.f.fault(ctx, op, c.db, c.coll)
+	if err != nil {
+		return nil, err
+	}
+
+	c.f.mu.Lock()
+	c = c.in(ctx)
+	defer c.f.mu.Unlock()
+
+	n, _, err := c.delete(filter, many)
+	if err != nil {
+		return nil, err
+	}
+
+	return &driver.DeleteResult{DeletedCount: n}, nil
+}
+
+func (c *collClient) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*driver.UpdateResult, error) {
+	return c.updateOp(ctx, "UpdateOne", filter, update, false, opts)
+}
+
+func (c *collClient) UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*driver.UpdateResult, error) {
+	return c.updateOp(ctx, "UpdateMany", filter, update, true, opts)
+}
+
+func (c *collClient) updateOp(ctx context.Context, op string, filter, update interface{}, many bool, opts []*options.UpdateOptions) (*driver.UpdateResult, error) {
+	err := c.f.fault(ctx, op, c.db, c.coll)
+	if err != nil {
+		return nil, err
+	}
+
+	c.f.mu.Lock()
+	c = c.in(ctx)
+	defer c.f.mu.Unlock()
+
+	o := options.MergeUpdateOptions(opts...)
+	result, _, _, err := c.update(filter, update, o.Upsert != nil && *o.Upsert, many)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (c *collClient) CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
+	err := c.f.fault(ctx, "CountDocuments", c.db, c.coll)
+	if err != nil {
+		return 0, err
+	}
+
+	c.f.mu.Lock()
+	c = c.in(ctx)
+	defer c.f.mu.Unlock()
+
+	o := options.MergeCountOptions(opts...)
+	docs, err := c.query(filter, nil, o.Skip, o.Limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(docs)), nil
+}
+
+func (c *collClient) Aggregate(ctx context.Context, pipeline interface{}, _ ...*options.AggregateOptions) (*driver.Cursor, error) {
+	err := c.f.fault(ctx, "Aggregate", c.db, c.coll)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped := struct {
+		Stages []bson.Raw `bson:"stages"`
+	}{}
+	b, err := bson.Marshal(bson.M{"stages": pipeline})
+	if err != nil {
+		return nil, err
+	}
+	err = bson.Unmarshal(b, &wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	c = c.in(ctx)
+
+	docs, err := c.query(bson.M{}, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	from := func(coll string) []bson.M {
+		scoped := *c
+		scoped.coll = coll
+		return scoped.docs()
+	}
+
+	docs, err = applyPipeline(docs, wrapped.Stages, from)
+	if err != nil {
+		return nil, err
+	}
+
+	return driver.NewCursorFromDocuments(toDocs(docs), nil, nil)
+}
+
+func (c *collClient) BulkWrite(ctx context.Context, models []driver.WriteModel, opts ...*options.BulkWriteOptions) (*driver.BulkWriteResult, error) {
+	err := c.f.fault(ctx, "BulkWrite", c.db, c.coll)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(models) == 0 {
+		return nil, driver.ErrEmptySlice
+	}
+
+	c.f.mu.Lock()
+	c = c.in(ctx)
+	defer c.f.mu.Unlock()
+
+	o := options.MergeBulkWriteOptions(opts...)
+	ordered := o.Ordered == nil || *o.Ordered
+
+	result := &driver.BulkWriteResult{UpsertedIDs: map[int64]interface{}{}}
+	writeErrs := driver.BulkWriteException{}
+	for i, model := range models {
+		err := c.applyModel(int64(i), model, result)
+		if err != nil {
+			writeErrs.WriteErrors = append(writeErrs.WriteErrors, bulkWriteError(i, err))
+			if ordered {
+				break
+			}
+		}
+	}
+
+	if len(writeErrs.WriteErrors) > 0 {
+		return result, writeErrs
+	}
+
+	return result, nil
+}
+
+func (c *collClient) applyModel(i int64, model driver.WriteModel, result *driver.BulkWriteResult) error {
+	var res *driver.UpdateResult
+	var err error
+	switch m := model.(type) {
+	case *driver.InsertOneModel:
+		_, err = c.insert(m.Document)
+		if err == nil {
+			result.InsertedCount++
+		}
+		return err
+	case *driver.UpdateOneModel:
+		res, _, _, err = c.update(m.Filter, m.Update, m.Upsert != nil && *m.Upsert, false)
+	case *driver.UpdateManyModel:
+		res, _, _, err = c.update(m.Filter, m.Update, m.Upsert != nil && *m.Upsert, true)
+	case *driver.ReplaceOneModel:
+		res, _, _, err = c.update(m.Filter, m.Replacement, m.Upsert != nil && *m.Upsert, false)
+	case *driver.DeleteOneModel:
+		var n int64
+		n, _, err = c.delete(m.Filter, false)
+		result.DeletedCount += n
+		return err
+	case *driver.DeleteManyModel:
+		var n int64
+		n, _, err = c.delete(m.Filter, true)
+		result.DeletedCount += n
+		return err
+	default:
+		return fmt.Errorf("mongotest: unsupported write model %T", model)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	result.MatchedCount += res.MatchedCount
+	result.ModifiedCount += res.ModifiedCount
+	result.UpsertedCount += res.UpsertedCount
+	if res.UpsertedID != nil {
+		result.UpsertedIDs[i] = res.UpsertedID
+	}
+
+	return nil
+}
+
+func bulkWriteError(i int, err error) driver.BulkWriteError {
+	we := driver.WriteError{Index: i, Message: err.Error()}
+	var wex driver.WriteException
+	if errors.As(err, &wex) && len(wex.WriteErrors) > 0 {
+		we.Code = wex.WriteErrors[0].Code
+		we.Message = wex.WriteErrors[0].Message
+	}
+
+	return driver.BulkWriteError{WriteError: we}
+}
+
+func (c *collClient) Watch(ctx context.Context, _ interface{}, _ ...*options.ChangeStreamOptions) (*driver.ChangeStream, error) {
+	err := c.f.fault(ctx, "Watch", c.db, c.coll)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, fmt.Errorf("mongotest: change streams: %w", ErrUnsupported)
+}
@@ -0,0 +1,620 @@
+package mongotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	duplicateKeyCode      = 11000
+	namespaceNotFoundCode = 26
+	indexNotFoundCode     = 27
+	writeConflictCode     = 112
+)
+
+var (
+	ErrTimeout     = context.DeadlineExceeded
+	ErrUnsupported = errors.New("mongotest: operation is not supported by the fake")
+)
+
+type Fault struct {
+	Op    string
+	DB    string
+	Coll  string
+	Err   error
+	Delay time.Duration
+	Times int
+}
+
+type collMeta struct {
+	options bson.M
+	indexes []bson.M
+}
+
+type namespace struct {
+	db   string
+	coll string
+}
+
+type Fake struct {
+	mu       sync.Mutex
+	dbs      map[string]map[string][]bson.M
+	meta     map[string]map[string]*collMeta
+	versions map[namespace]uint64
+	faults   []*Fault
+}
+
+func New() *Fake {
+	return &Fake{
+		dbs:      map[string]map[string][]bson.M{},
+		meta:     map[string]map[string]*collMeta{},
+		versions: map[namespace]uint64{},
+	}
+}
+
+func NewHelper(opts ...mongo.Option) (*mongo.Helper, *Fake, error) {
+	f := New()
+	h, err := mongo.NewHelperWithBackend(f, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return h, f, nil
+}
+
+func DuplicateKeyError(key string) error {
+	return driver.WriteException{
+		WriteErrors: driver.WriteErrors{{
+			Index:   0,
+			Code:    duplicateKeyCode,
+			Message: fmt.Sprintf("E11000 duplicate key error dup key: %s", key),
+		}},
+	}
+}
+
+func LabeledError(labels ...string) error {
+	return driver.CommandError{
+		Code:    writeConflictCode,
+		Name:    "WriteConflict",
+		Message: "mongotest: injected labeled error",
+		Labels:  labels,
+	}
+}
+
+func (f *Fake) Inject(faults ...Fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range faults {
+		fault := faults[i]
+		f.faults = append(f.faults, &fault)
+	}
+}
+
+func (f *Fake) ResetFaults() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = nil
+}
+
+func (f *Fake) Clear() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dbs = map[string]map[string][]bson.M{}
+	f.meta = map[string]map[string]*collMeta{}
+	f.versions = map[namespace]uint64{}
+}
+
+func (f *Fake) Seed(db, coll string, docs ...interface{}) error {
+	_, err := f.Collection(db, coll).InsertMany(context.Background(), docs)
+	return err
+}
+
+func (f *Fake) Docs(db, coll string) []bson.M {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	docs := []bson.M{}
+	for _, d := range f.dbs[db][coll] {
+		docs = append(docs, clone(d))
+	}
+
+	return docs
+}
+
+func (f *Fake) fault(ctx context.Context, op, db, coll string) error {
+	f.mu.Lock()
+	var hit *Fault
+	for i, fault := range f.faults {
+		if (fault.Op != "" && fault.Op != op) || (fault.DB != "" && fault.DB != db) || (fault.Coll != "" && fault.Coll != coll) {
+			continue
+		}
+
+		hit = fault
+		if fault.Times > 0 {
+			fault.Times--
+			if fault.Times == 0 {
+				f.faults = append(f.faults[:i], f.faults[i+1:]...)
+			}
+		}
+		break
+	}
+	f.mu.Unlock()
+
+	if hit == nil {
+		return nil
+	}
+
+	if hit.Delay > 0 {
+		t := time.NewTimer(hit.Delay)
+		defer t.Stop()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+
+	return hit.Err
+}
+
+func (f *Fake) coll(db, coll string) []bson.M {
+	return f.dbs[db][coll]
+}
+
+func (f *Fake) setColl(db, coll string, docs []bson.M) {
+	if f.dbs[db] == nil {
+		f.dbs[db] = map[string][]bson.M{}
+	}
+
+	f.dbs[db][coll] = docs
+	f.versions[namespace{db, coll}]++
+}
+
+func (f *Fake) dropColl(db, coll string) {
+	delete(f.dbs[db], coll)
+	delete(f.meta[db], coll)
+	f.versions[namespace{db, coll}]++
+}
+
+func (f *Fake) collMeta(db, coll string) *collMeta {
+	if f.meta[db] == nil {
+		f.meta[db] = map[string]*collMeta{}
+	}
+
+	m, ok := f.meta[db][coll]
+	if !ok {
+		m = &collMeta{options: bson.M{}}
+		f.meta[db][coll] = m
+	}
+
+	return m
+}
+
+func (f *Fake) Database(db string) mongo.DBClient {
+	return &dbClient{f: f, db: db}
+}
+
+func (f *Fake) Collection(db, coll string) mongo.CollClient {
+	return &collClient{f: f, db: db, coll: coll}
+}
+
+func (f *Fake) StartSession() (mongo.TxnClient, error) {
+	err := f.fault(context.Background(), "StartSession", "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &session{f: f}, nil
+}
+
+func (f *Fake) Ping(ctx context.Context) error {
+	return f.fault(ctx, "Ping", "", "")
+}
+
+func (f *Fake) Disconnect(ctx context.Context) error {
+	return f.fault(ctx, "Disconnect", "", "")
+}
+
+type dbClient struct {
+	f  *Fake
+	db string
+}
+
+// Collection cannot hand out a *mongo.Collection without a live client, so it
+// panics with ErrUnsupported. Use Fake.Collection or Helper.NewCollCli instead.
+func (d *dbClient) Collection(coll string, _ ...*options.CollectionOptions) *driver.Collection {
+	panic(fmt.Errorf("%w: Database(%s).Collection(%s), use Fake.Collection instead", ErrUnsupported, d.db, coll))
+}
+
+func (d *dbClient) ListCollectionNames(ctx context.Context, _ interface{}, _ ...*options.ListCollectionsOptions) ([]string, error) {
+	err := d.f.fault(ctx, "ListCollectionNames", d.db, "")
+	if err != nil {
+		return nil, err
+	}
+
+	d.f.mu.Lock()
+	defer d.f.mu.Unlock()
+
+	names := []string{}
+	for name := range d.f.dbs[d.db] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (d *dbClient) RunCommand(ctx context.Context, cmd interface{}, _ ...*options.RunCmdOptions) *driver.SingleResult {
+	ok := bson.M{"ok": 1}
+	elems, err := elements(cmd)
+	if err != nil {
+		return driver.NewSingleResultFromDocument(ok, err, nil)
+	}
+
+	if len(elems) == 0 {
+		return driver.NewSingleResultFromDocument(ok, fmt.Errorf("mongotest: empty command"), nil)
+	}
+
+	name := elems[0].Key
+	coll, _ := elems[0].Value.(string)
+	err = d.f.fault(ctx, name, d.db, coll)
+	if err != nil {
+		return driver.NewSingleResultFromDocument(ok, err, nil)
+	}
+
+	d.f.mu.Lock()
+	defer d.f.mu.Unlock()
+
+	_, exists := d.f.dbs[d.db][coll]
+	switch name {
+	case "create":
+		if !exists {
+			d.f.setColl(d.db, coll, []bson.M{})
+			m := d.f.collMeta(d.db, coll)
+			for _, e := range elems[1:] {
+				m.options[e.Key] = e.Value
+			}
+		}
+	case "createIndexes":
+		if !exists {
+			d.f.setColl(d.db, coll, []bson.M{})
+		}
+		d.f.createIndexes(d.db, coll, elems)
+	case "collMod":
+		if !exists {
+			err = namespaceNotFound(d.db, coll)
+			break
+		}
+		err = d.f.collMod(d.db, coll, elems)
+	case "drop":
+		d.f.dropColl(d.db, coll)
+	case "dropIndexes":
+		if !exists {
+			err = namespaceNotFound(d.db, coll)
+			break
+		}
+		err = d.f.dropIndex(d.db, coll, elems)
+	case "listCollections":
+		return driver.NewSingleResultFromDocument(d.f.listCollections(d.db, elems), nil, nil)
+	case "listIndexes":
+		if !exists {
+			err = namespaceNotFound(d.db, coll)
+			break
+		}
+		return driver.NewSingleResultFromDocument(d.f.listIndexes(d.db, coll), nil, nil)
+	}
+
+	return driver.NewSingleResultFromDocument(ok, err, nil)
+}
+
+func namespaceNotFound(db, coll string) error {
+	return driver.CommandError{
+		Code:    namespaceNotFoundCode,
+		Name:    "NamespaceNotFound",
+		Message: fmt.Sprintf("ns does not exist: %s.%s", db, coll),
+	}
+}
+
+func cursorReply(db, coll string, batch bson.A) bson.M {
+	return bson.M{
+		"ok": 1,
+		"cursor": bson.M{
+			"id":         int64(0),
+			"ns":         db + "." + coll,
+			"firstBatch": batch,
+		},
+	}
+}
+
+func command(elems []bson.E, key string) (interface{}, bool) {
+	for _, e := range elems {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+func (f *Fake) createIndexes(db, coll string, elems []bson.E) {
+	v, _ := command(elems, "indexes")
+	specs, _ := v.(bson.A)
+
+	m := f.collMeta(db, coll)
+	for _, s := range specs {
+		spec, err := normalize(s)
+		if err != nil {
+			continue
+		}
+
+		exists := false
+		for _, i := range m.indexes {
+			if i["name"] == spec["name"] {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			m.indexes = append(m.indexes, spec)
+		}
+	}
+}
+
+func (f *Fake) collMod(db, coll string, elems []bson.E) error {
+	m := f.collMeta(db, coll)
+	if v, ok := command(elems, "validator"); ok {
+		m.options["validator"] = v
+	}
+
+	v, ok := command(elems, "index")
+	if !ok {
+		return nil
+	}
+
+	spec, err := normalize(v)
+	if err != nil {
+		return err
+	}
+
+	for _, i := range m.indexes {
+		if i["name"] == spec["name"] || fmt.Sprint(i["key"]) == fmt.Sprint(spec["keyPattern"]) {
+			i["expireAfterSeconds"] = spec["expireAfterSeconds"]
+			return nil
+		}
+	}
+
+	return driver.CommandError{
+		Code:    indexNotFoundCode,
+		Name:    "IndexNotFound",
+		Message: fmt.Sprintf("cannot find index for %s.%s", db, coll),
+	}
+}
+
+func (f *Fake) dropIndex(db, coll string, elems []bson.E) error {
+	v, _ := command(elems, "index")
+	name, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("mongotest: dropIndexes requires an index name")
+	}
+
+	m := f.collMeta(db, coll)
+	for n, i := range m.indexes {
+		if i["name"] == name {
+			m.indexes = append(m.indexes[:n], m.indexes[n+1:]...)
+			return nil
+		}
+	}
+
+	return driver.CommandError{
+		Code:    indexNotFoundCode,
+		Name:    "IndexNotFound",
+		Message: fmt.Sprintf("index not found with name [%s]", name),
+	}
+}
+
+func (f *Fake) listCollections(db string, elems []bson.E) bson.M {
+	name := ""
+	if v, ok := command(elems, "filter"); ok {
+		filter, err := normalize(v)
+		if err == nil {
+			name, _ = filter["name"].(string)
+		}
+	}
+
+	names := []string{}
+	for coll := range f.dbs[db] {
+		if name == "" || coll == name {
+			names = append(names, coll)
+		}
+	}
+	sort.Strings(names)
+
+	batch := bson.A{}
+	for _, coll := range names {
+		batch = append(batch, bson.M{
+			"name":    coll,
+			"type":    "collection",
+			"options": f.collMeta(db, coll).options,
+		})
+	}
+
+	return cursorReply(db, "$cmd.listCollections", batch)
+}
+
+func (f *Fake) listIndexes(db, coll string) bson.M {
+	batch := bson.A{bson.M{"v": 2, "key": bson.M{"_id": 1}, "name": "_id_"}}
+	for _, i := range f.collMeta(db, coll).indexes {
+		batch = append(batch, i)
+	}
+
+	return cursorReply(db, coll, batch)
+}
+
+type txnState struct {
+	colls    map[namespace][]bson.M
+	versions map[namespace]uint64
+	dirty    map[namespace]bool
+}
+
+func (t *txnState) coll(f *Fake, db, coll string) []bson.M {
+	ns := namespace{db, coll}
+	docs, ok := t.colls[ns]
+	if ok {
+		return docs
+	}
+
+	docs = make([]bson.M, 0, len(f.coll(db, coll)))
+	for _, d := range f.coll(db, coll) {
+		docs = append(docs, clone(d))
+	}
+	t.colls[ns] = docs
+	t.versions[ns] = f.versions[ns]
+
+	return docs
+}
+
+func (t *txnState) setColl(f *Fake, db, coll string, docs []bson.M) {
+	ns := namespace{db, coll}
+	if _, ok := t.colls[ns]; !ok {
+		t.versions[ns] = f.versions[ns]
+	}
+
+	t.colls[ns] = docs
+	t.dirty[ns] = true
+}
+
+// session implements every exported method of mongo.Session. The embedded
+// interface is always nil, it only provides the driver's unexported marker
+// method so the fake can be passed to mongo.NewSessionContext.
+type session struct {
+	driver.Session
+	f   *Fake
+	txn *txnState
+}
+
+func (s *session) ClusterTime() bson.Raw {
+	return nil
+}
+
+func (s *session) OperationTime() *primitive.Timestamp {
+	return nil
+}
+
+func (s *session) Client() *driver.Client {
+	return nil
+}
+
+func (s *session) ID() bson.Raw {
+	return nil
+}
+
+func (s *session) AdvanceClusterTime(bson.Raw) error {
+	return fmt.Errorf("%w: AdvanceClusterTime", ErrUnsupported)
+}
+
+func (s *session) AdvanceOperationTime(*primitive.Timestamp) error {
+	return fmt.Errorf("%w: AdvanceOperationTime", ErrUnsupported)
+}
+
+func (s *session) StartTransaction(...*options.TransactionOptions) error {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+
+	if s.txn != nil {
+		return fmt.Errorf("mongotest: transaction already in progress")
+	}
+
+	s.txn = &txnState{
+		colls:    map[namespace][]bson.M{},
+		versions: map[namespace]uint64{},
+		dirty:    map[namespace]bool{},
+	}
+	return nil
+}
+
+func (s *session) AbortTransaction(ctx context.Context) error {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+
+	if s.txn == nil {
+		return fmt.Errorf("mongotest: no transaction started")
+	}
+
+	s.txn = nil
+	return nil
+}
+
+func (s *session) CommitTransaction(ctx context.Context) error {
+	err := s.f.fault(ctx, "CommitTransaction", "", "")
+	if err != nil {
+		return err
+	}
+
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+
+	if s.txn == nil {
+		return fmt.Errorf("mongotest: no transaction started")
+	}
+
+	txn := s.txn
+	s.txn = nil
+	for ns := range txn.dirty {
+		if s.f.versions[ns] != txn.versions[ns] {
+			return driver.CommandError{
+				Code:    writeConflictCode,
+				Name:    "WriteConflict",
+				Message: fmt.Sprintf("mongotest: %s.%s was modified outside the transaction", ns.db, ns.coll),
+				Labels:  []string{"TransientTransactionError"},
+			}
+		}
+	}
+
+	for ns := range txn.dirty {
+		s.f.setColl(ns.db, ns.coll, txn.colls[ns])
+	}
+
+	return nil
+}
+
+func (s *session) WithTransaction(ctx context.Context, fn func(driver.SessionContext) (interface{}, error), opts ...*options.TransactionOptions) (interface{}, error) {
+	err := s.StartTransaction(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := fn(driver.NewSessionContext(ctx, s))
+	if err != nil {
+		abortErr := s.AbortTransaction(ctx)
+		if abortErr != nil {
+			return nil, abortErr
+		}
+
+		return nil, err
+	}
+
+	err = s.CommitTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *session) EndSession(ctx context.Context) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	s.txn = nil
+}
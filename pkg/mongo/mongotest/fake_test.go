@@ -0,0 +1,396 @@
+package mongotest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	testDB = "db"
+)
+
+func newTestHelper(t *testing.T) (*mongo.Helper, *Fake) {
+	t.Helper()
+
+	h, f, err := NewHelper()
+	if err != nil {
+		t.Fatalf("failed to create helper: %s", err.Error())
+	}
+
+	return h, f
+}
+
+func aggregate(t *testing.T, f *Fake, coll string, p mongo.Pipeline) []bson.M {
+	t.Helper()
+
+	ctx := context.Background()
+	cursor, err := f.Collection(testDB, coll).Aggregate(ctx, p)
+	if err != nil {
+		t.Fatalf("aggregate failed: %s", err.Error())
+	}
+
+	docs := []bson.M{}
+	err = cursor.All(ctx, &docs)
+	if err != nil {
+		t.Fatalf("failed to decode aggregate results: %s", err.Error())
+	}
+
+	return docs
+}
+
+func TestCRUD(t *testing.T) {
+	h, f := newTestHelper(t)
+
+	err := h.Insert(testDB, "users", bson.M{"_id": "u1", "name": "alice", "age": 30})
+	if err != nil {
+		t.Fatalf("insert failed: %s", err.Error())
+	}
+
+	err = h.UpdateOne(testDB, "users", bson.M{"_id": "u1"}, bson.M{"$set": bson.M{"age": 31}})
+	if err != nil {
+		t.Fatalf("update failed: %s", err.Error())
+	}
+
+	result, err := h.Get(testDB, "users", bson.M{"name": "alice"})
+	if err != nil {
+		t.Fatalf("get failed: %s", err.Error())
+	}
+
+	doc := bson.M{}
+	err = result.Decode(&doc)
+	if err != nil {
+		t.Fatalf("decode failed: %s", err.Error())
+	}
+	if doc["age"] != int32(31) {
+		t.Fatalf("unexpected age. got: %v", doc["age"])
+	}
+
+	err = h.DeleteOne(testDB, "users", bson.M{"_id": "u1"})
+	if err != nil {
+		t.Fatalf("delete failed: %s", err.Error())
+	}
+	if docs := f.Docs(testDB, "users"); len(docs) != 0 {
+		t.Fatalf("expected no docs after delete. got: %v", docs)
+	}
+}
+
+func TestDocsAreIsolatedCopies(t *testing.T) {
+	_, f := newTestHelper(t)
+
+	err := f.Seed(testDB, "users", bson.M{"_id": "u1", "tags": bson.A{"a"}})
+	if err != nil {
+		t.Fatalf("seed failed: %s", err.Error())
+	}
+
+	docs := f.Docs(testDB, "users")
+	docs[0]["tags"] = append(docs[0]["tags"].(bson.A), "b")
+
+	tags := f.Docs(testDB, "users")[0]["tags"].(bson.A)
+	if len(tags) != 1 {
+		t.Fatalf("stored document was mutated through Docs. got: %v", tags)
+	}
+}
+
+func TestAggregateGroup(t *testing.T) {
+	_, f := newTestHelper(t)
+
+	err := f.Seed(testDB, "orders",
+		bson.M{"_id": 1, "user": "a", "total": 10},
+		bson.M{"_id": 2, "user": "b", "total": 5},
+		bson.M{"_id": 3, "user": "a", "total": 7},
+	)
+	if err != nil {
+		t.Fatalf("seed failed: %s", err.Error())
+	}
+
+	p := mongo.NewPipeline().
+		Group("$user", bson.M{
+			"count": bson.M{"$sum": 1},
+			"total": bson.M{"$sum": "$total"},
+			"max":   bson.M{"$max": "$total"},
+			"ids":   bson.M{"$push": "$_id"},
+		}).
+		Sort(bson.D{{Key: "_id", Value: 1}})
+
+	got := aggregate(t, f, "orders", p)
+	want := []bson.M{
+		{"_id": "a", "count": int64(2), "total": int64(17), "max": int32(10), "ids": bson.A{int32(1), int32(3)}},
+		{"_id": "b", "count": int64(1), "total": int64(5), "max": int32(5), "ids": bson.A{int32(2)}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected group result.\ngot:  %v\nwant: %v", got, want)
+	}
+}
+
+func TestAggregateLookupUnwind(t *testing.T) {
+	_, f := newTestHelper(t)
+
+	err := f.Seed(testDB, "users", bson.M{"_id": "a", "name": "alice"}, bson.M{"_id": "b", "name": "bob"})
+	if err != nil {
+		t.Fatalf("seed failed: %s", err.Error())
+	}
+	err = f.Seed(testDB, "orders", bson.M{"_id": 1, "user": "a"}, bson.M{"_id": 2, "user": "c"})
+	if err != nil {
+		t.Fatalf("seed failed: %s", err.Error())
+	}
+
+	p := mongo.NewPipeline().
+		Lookup("users", "user", "_id", "owner").
+		Unwind("$owner", false).
+		Project(bson.M{"_id": 1, "owner": 1})
+
+	got := aggregate(t, f, "orders", p)
+	want := []bson.M{{"_id": int32(1), "owner": bson.M{"_id": "a", "name": "alice"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected lookup result.\ngot:  %v\nwant: %v", got, want)
+	}
+
+	p = mongo.NewPipeline().
+		Lookup("users", "user", "_id", "owner").
+		Unwind("$owner", true).
+		Sort(bson.D{{Key: "_id", Value: 1}})
+
+	got = aggregate(t, f, "orders", p)
+	if len(got) != 2 {
+		t.Fatalf("expected preserveNullAndEmptyArrays to keep unmatched orders. got: %v", got)
+	}
+	if _, ok := got[1]["owner"]; ok {
+		t.Fatalf("expected empty owner to be removed. got: %v", got[1])
+	}
+}
+
+func TestAggregateFacet(t *testing.T) {
+	_, f := newTestHelper(t)
+
+	err := f.Seed(testDB, "items", bson.M{"_id": 1, "kind": "x"}, bson.M{"_id": 2, "kind": "y"}, bson.M{"_id": 3, "kind": "x"})
+	if err != nil {
+		t.Fatalf("seed failed: %s", err.Error())
+	}
+
+	p := mongo.NewPipeline().Facet(map[string]mongo.Pipeline{
+		"total": mongo.NewPipeline().Stage("$count", "n"),
+		"xs":    mongo.NewPipeline().Match(bson.M{"kind": "x"}).Sort(bson.D{{Key: "_id", Value: -1}}).Limit(1),
+	})
+
+	got := aggregate(t, f, "items", p)
+	want := []bson.M{{
+		"total": bson.A{bson.M{"n": int32(3)}},
+		"xs":    bson.A{bson.M{"_id": int32(3), "kind": "x"}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected facet result.\ngot:  %v\nwant: %v", got, want)
+	}
+}
+
+func TestAggregateUnsupported(t *testing.T) {
+	_, f := newTestHelper(t)
+
+	pipelines := []mongo.Pipeline{
+		mongo.NewPipeline().Stage("$bucket", bson.M{}),
+		mongo.NewPipeline().Group(bson.M{"$toUpper": "$name"}, bson.M{}),
+		mongo.NewPipeline().Group("$name", bson.M{"n": bson.M{"$stdDevPop": "$age"}}),
+	}
+	err := f.Seed(testDB, "users", bson.M{"_id": 1, "name": "a", "age": 1})
+	if err != nil {
+		t.Fatalf("seed failed: %s", err.Error())
+	}
+
+	for _, p := range pipelines {
+		_, err := f.Collection(testDB, "users").Aggregate(context.Background(), p)
+		if !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("expected ErrUnsupported for %v. got: %v", p, err)
+		}
+	}
+}
+
+func TestRunInTxnCommit(t *testing.T) {
+	h, f := newTestHelper(t)
+
+	err := h.RunInTxn(context.Background(), func(ctx driver.SessionContext) error {
+		err := h.InsertCtx(ctx, testDB, "users", bson.M{"_id": "u1"})
+		if err != nil {
+			return err
+		}
+
+		if docs := f.Docs(testDB, "users"); len(docs) != 0 {
+			t.Errorf("uncommitted write is visible outside the transaction: %v", docs)
+		}
+
+		count, err := h.GetCountCtx(ctx, testDB, "users", bson.M{})
+		if err != nil {
+			return err
+		}
+		if count != 1 {
+			t.Errorf("transaction cannot see its own write. count: %d", count)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("transaction failed: %s", err.Error())
+	}
+
+	if docs := f.Docs(testDB, "users"); len(docs) != 1 {
+		t.Fatalf("expected committed doc. got: %v", docs)
+	}
+}
+
+func TestRunInTxnAbort(t *testing.T) {
+	h, f := newTestHelper(t)
+
+	err := f.Seed(testDB, "users", bson.M{"_id": "keep"})
+	if err != nil {
+		t.Fatalf("seed failed: %s", err.Error())
+	}
+
+	errBoom := errors.New("boom")
+	err = h.RunInTxn(context.Background(), func(ctx driver.SessionContext) error {
+		err := h.InsertCtx(ctx, testDB, "users", bson.M{"_id": "u1"})
+		if err != nil {
+			return err
+		}
+
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("expected fn error. got: %v", err)
+	}
+
+	docs := f.Docs(testDB, "users")
+	if len(docs) != 1 || docs[0]["_id"] != "keep" {
+		t.Fatalf("aborted transaction leaked writes. got: %v", docs)
+	}
+}
+
+func TestAbortDoesNotDiscardOtherWrites(t *testing.T) {
+	_, f := newTestHelper(t)
+	ctx := context.Background()
+
+	txn, err := f.StartSession()
+	if err != nil {
+		t.Fatalf("failed to start session: %s", err.Error())
+	}
+	sess := txn.(driver.Session)
+	defer sess.EndSession(ctx)
+
+	err = sess.StartTransaction()
+	if err != nil {
+		t.Fatalf("failed to start transaction: %s", err.Error())
+	}
+
+	sessCtx := driver.NewSessionContext(ctx, sess)
+	_, err = f.Collection(testDB, "users").InsertOne(sessCtx, bson.M{"_id": "in-txn"})
+	if err != nil {
+		t.Fatalf("insert in txn failed: %s", err.Error())
+	}
+
+	_, err = f.Collection(testDB, "events").InsertOne(ctx, bson.M{"_id": "outside"})
+	if err != nil {
+		t.Fatalf("insert outside txn failed: %s", err.Error())
+	}
+
+	err = sess.AbortTransaction(ctx)
+	if err != nil {
+		t.Fatalf("abort failed: %s", err.Error())
+	}
+
+	if docs := f.Docs(testDB, "events"); len(docs) != 1 {
+		t.Fatalf("abort discarded a write made outside the transaction. got: %v", docs)
+	}
+	if docs := f.Docs(testDB, "users"); len(docs) != 0 {
+		t.Fatalf("aborted write is visible. got: %v", docs)
+	}
+}
+
+func TestCommitWriteConflict(t *testing.T) {
+	_, f := newTestHelper(t)
+	ctx := context.Background()
+
+	txn, err := f.StartSession()
+	if err != nil {
+		t.Fatalf("failed to start session: %s", err.Error())
+	}
+	sess := txn.(driver.Session)
+	defer sess.EndSession(ctx)
+
+	err = sess.StartTransaction()
+	if err != nil {
+		t.Fatalf("failed to start transaction: %s", err.Error())
+	}
+
+	_, err = f.Collection(testDB, "users").InsertOne(driver.NewSessionContext(ctx, sess), bson.M{"_id": "a"})
+	if err != nil {
+		t.Fatalf("insert in txn failed: %s", err.Error())
+	}
+
+	_, err = f.Collection(testDB, "users").InsertOne(ctx, bson.M{"_id": "b"})
+	if err != nil {
+		t.Fatalf("insert outside txn failed: %s", err.Error())
+	}
+
+	err = sess.CommitTransaction(ctx)
+	var cmdErr driver.CommandError
+	if !errors.As(err, &cmdErr) || !cmdErr.HasErrorLabel("TransientTransactionError") {
+		t.Fatalf("expected transient write conflict. got: %v", err)
+	}
+
+	docs := f.Docs(testDB, "users")
+	if len(docs) != 1 || docs[0]["_id"] != "b" {
+		t.Fatalf("conflicting commit was applied. got: %v", docs)
+	}
+}
+
+func TestDatabaseCollectionIsUnsupported(t *testing.T) {
+	_, f := newTestHelper(t)
+
+	defer func() {
+		err, _ := recover().(error)
+		if !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("expected ErrUnsupported panic. got: %v", err)
+		}
+	}()
+
+	f.Database(testDB).Collection("users")
+}
+
+func TestSessionUnsupported(t *testing.T) {
+	_, f := newTestHelper(t)
+
+	txn, err := f.StartSession()
+	if err != nil {
+		t.Fatalf("failed to start session: %s", err.Error())
+	}
+
+	sess := txn.(driver.Session)
+	defer sess.EndSession(context.Background())
+
+	if err := sess.AdvanceClusterTime(nil); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported. got: %v", err)
+	}
+	if err := sess.AdvanceOperationTime(nil); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported. got: %v", err)
+	}
+}
+
+func TestInjectedFault(t *testing.T) {
+	h, f := newTestHelper(t)
+
+	errBoom := errors.New("boom")
+	f.Inject(Fault{Op: "InsertOne", Coll: "users", Err: errBoom, Times: 1})
+
+	err := h.Insert(testDB, "users", bson.M{"_id": "u1"})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("expected injected fault. got: %v", err)
+	}
+
+	err = h.Insert(testDB, "users", bson.M{"_id": "u1"})
+	if err != nil {
+		t.Fatalf("fault should only fire once: %s", err.Error())
+	}
+}
@@ -0,0 +1,665 @@
+package mongotest
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func normalize(v interface{}) (bson.M, error) {
+	if v == nil {
+		return bson.M{}, nil
+	}
+
+	b, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	m := bson.M{}
+	err = bson.Unmarshal(b, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch v := v.(type) {
+	case bson.M:
+		return clone(v)
+	case bson.D:
+		d := make(bson.D, len(v))
+		for i, e := range v {
+			d[i] = bson.E{Key: e.Key, Value: deepCopy(e.Value)}
+		}
+		return d
+	case bson.A:
+		a := make(bson.A, len(v))
+		for i, e := range v {
+			a[i] = deepCopy(e)
+		}
+		return a
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, e := range v {
+			a[i] = deepCopy(e)
+		}
+		return a
+	case primitive.Binary:
+		return primitive.Binary{Subtype: v.Subtype, Data: append([]byte{}, v.Data...)}
+	case []byte:
+		return append([]byte{}, v...)
+	}
+
+	return v
+}
+
+func clone(doc bson.M) bson.M {
+	if doc == nil {
+		return nil
+	}
+
+	m := make(bson.M, len(doc))
+	for k, v := range doc {
+		m[k] = deepCopy(v)
+	}
+
+	return m
+}
+
+func elements(v interface{}) ([]bson.E, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	b, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	d := bson.D{}
+	err = bson.Unmarshal(b, &d)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func lookup(doc interface{}, path string) (interface{}, bool) {
+	cur := doc
+	for _, part := range strings.Split(path, ".") {
+		switch v := cur.(type) {
+		case bson.M:
+			next, ok := v[part]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case bson.D:
+			found := false
+			for _, e := range v {
+				if e.Key == part {
+					cur, found = e.Value, true
+					break
+				}
+			}
+			if !found {
+				return nil, false
+			}
+		case bson.A:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			cur = v[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return cur, true
+}
+
+func setPath(doc bson.M, path string, value interface{}) error {
+	parts := strings.Split(path, ".")
+	cur := doc
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := cur[part]
+		if !ok || next == nil {
+			m := bson.M{}
+			cur[part] = m
+			cur = m
+			continue
+		}
+
+		m, ok := next.(bson.M)
+		if !ok {
+			return fmt.Errorf("mongotest: cannot set %s: %s is not a document", path, part)
+		}
+		cur = m
+	}
+
+	cur[parts[len(parts)-1]] = value
+	return nil
+}
+
+func unsetPath(doc bson.M, path string) {
+	parts := strings.Split(path, ".")
+	cur := doc
+	for _, part := range parts[:len(parts)-1] {
+		m, ok := cur[part].(bson.M)
+		if !ok {
+			return
+		}
+		cur = m
+	}
+
+	delete(cur, parts[len(parts)-1])
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+
+	return 0, false
+}
+
+func compare(a, b interface{}) (int, bool) {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+		if !ok {
+			return 0, false
+		}
+
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	switch va := a.(type) {
+	case string:
+		vb, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(va, vb), true
+	case bool:
+		vb, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		if va == vb {
+			return 0, true
+		}
+		if !va {
+			return -1, true
+		}
+		return 1, true
+	case primitive.DateTime:
+		vb, ok := b.(primitive.DateTime)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case va < vb:
+			return -1, true
+		case va > vb:
+			return 1, true
+		}
+		return 0, true
+	case primitive.ObjectID:
+		vb, ok := b.(primitive.ObjectID)
+		if !ok {
+			return 0, false
+		}
+		return bytes.Compare(va[:], vb[:]), true
+	}
+
+	return 0, false
+}
+
+func equal(a, b interface{}) bool {
+	if c, ok := compare(a, b); ok {
+		return c == 0
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func eqMatch(v interface{}, exists bool, want interface{}) bool {
+	if want == nil {
+		return !exists || v == nil
+	}
+
+	if !exists {
+		return false
+	}
+
+	if arr, ok := v.(bson.A); ok {
+		for _, e := range arr {
+			if equal(e, want) {
+				return true
+			}
+		}
+	}
+
+	return equal(v, want)
+}
+
+func cmpMatch(v interface{}, exists bool, want interface{}, accept func(int) bool) bool {
+	if !exists {
+		return false
+	}
+
+	candidates := bson.A{v}
+	if arr, ok := v.(bson.A); ok {
+		candidates = arr
+	}
+
+	for _, c := range candidates {
+		r, ok := compare(c, want)
+		if ok && accept(r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isOperatorDoc(v interface{}) (bson.M, bool) {
+	m, ok := v.(bson.M)
+	if !ok || len(m) == 0 {
+		return nil, false
+	}
+
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return nil, false
+		}
+	}
+
+	return m, true
+}
+
+func match(doc bson.M, filter bson.M) (bool, error) {
+	for k, cond := range filter {
+		var ok bool
+		var err error
+		switch k {
+		case "$and", "$or", "$nor":
+			ok, err = matchLogical(doc, k, cond)
+		default:
+			if strings.HasPrefix(k, "$") {
+				return false, fmt.Errorf("mongotest: unsupported top-level operator %s", k)
+			}
+
+			v, exists := lookup(doc, k)
+			ops, isOps := isOperatorDoc(cond)
+			if isOps {
+				ok, err = matchOps(v, exists, ops)
+			} else {
+				ok = eqMatch(v, exists, cond)
+			}
+		}
+
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func matchLogical(doc bson.M, op string, cond interface{}) (bool, error) {
+	clauses, ok := cond.(bson.A)
+	if !ok {
+		return false, fmt.Errorf("mongotest: %s requires an array", op)
+	}
+
+	matched := 0
+	for _, c := range clauses {
+		f, ok := c.(bson.M)
+		if !ok {
+			return false, fmt.Errorf("mongotest: %s entries must be documents", op)
+		}
+
+		ok, err := match(doc, f)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			matched++
+		}
+	}
+
+	switch op {
+	case "$and":
+		return matched == len(clauses), nil
+	case "$or":
+		return matched > 0, nil
+	default:
+		return matched == 0, nil
+	}
+}
+
+func matchOps(v interface{}, exists bool, ops bson.M) (bool, error) {
+	for op, arg := range ops {
+		var ok bool
+		switch op {
+		case "$eq":
+			ok = eqMatch(v, exists, arg)
+		case "$ne":
+			ok = !eqMatch(v, exists, arg)
+		case "$in", "$nin":
+			values, isArr := arg.(bson.A)
+			if !isArr {
+				return false, fmt.Errorf("mongotest: %s requires an array", op)
+			}
+			for _, want := range values {
+				if eqMatch(v, exists, want) {
+					ok = true
+					break
+				}
+			}
+			if op == "$nin" {
+				ok = !ok
+			}
+		case "$gt":
+			ok = cmpMatch(v, exists, arg, func(r int) bool { return r > 0 })
+		case "$gte":
+			ok = cmpMatch(v, exists, arg, func(r int) bool { return r >= 0 })
+		case "$lt":
+			ok = cmpMatch(v, exists, arg, func(r int) bool { return r < 0 })
+		case "$lte":
+			ok = cmpMatch(v, exists, arg, func(r int) bool { return r <= 0 })
+		case "$exists":
+			want, _ := arg.(bool)
+			if n, isNum := toFloat(arg); isNum {
+				want = n != 0
+			}
+			ok = exists == want
+		case "$not":
+			sub, isOps := isOperatorDoc(arg)
+			if !isOps {
+				return false, fmt.Errorf("mongotest: $not requires an operator document")
+			}
+			matched, err := matchOps(v, exists, sub)
+			if err != nil {
+				return false, err
+			}
+			ok = !matched
+		default:
+			return false, fmt.Errorf("mongotest: unsupported query operator %s", op)
+		}
+
+		if !ok {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func isReplacement(update bson.M) bool {
+	for k := range update {
+		if strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func inc(a, b interface{}) (interface{}, error) {
+	if a == nil {
+		return b, nil
+	}
+
+	switch va := a.(type) {
+	case int32:
+		if vb, ok := b.(int32); ok {
+			return va + vb, nil
+		}
+	case int64:
+		switch vb := b.(type) {
+		case int32:
+			return va + int64(vb), nil
+		case int64:
+			return va + vb, nil
+		}
+	}
+
+	fa, ok := toFloat(a)
+	if !ok {
+		return nil, fmt.Errorf("mongotest: cannot apply $inc to non-numeric value")
+	}
+
+	fb, ok := toFloat(b)
+	if !ok {
+		return nil, fmt.Errorf("mongotest: $inc requires a numeric value")
+	}
+
+	if _, ok := a.(float64); !ok {
+		if _, ok := b.(float64); !ok {
+			return int64(fa + fb), nil
+		}
+	}
+
+	return fa + fb, nil
+}
+
+func applyUpdate(doc bson.M, update bson.M, inserting bool) error {
+	if isReplacement(update) {
+		id, hasID := doc["_id"]
+		for k := range doc {
+			delete(doc, k)
+		}
+		for k, v := range update {
+			doc[k] = v
+		}
+		if hasID {
+			doc["_id"] = id
+		}
+
+		return nil
+	}
+
+	for op, arg := range update {
+		fields, ok := arg.(bson.M)
+		if !ok {
+			return fmt.Errorf("mongotest: %s requires a document", op)
+		}
+
+		for path, value := range fields {
+			var err error
+			switch op {
+			case "$set":
+				err = setPath(doc, path, value)
+			case "$setOnInsert":
+				if inserting {
+					err = setPath(doc, path, value)
+				}
+			case "$unset":
+				unsetPath(doc, path)
+			case "$inc":
+				cur, _ := lookup(doc, path)
+				var next interface{}
+				next, err = inc(cur, value)
+				if err == nil {
+					err = setPath(doc, path, next)
+				}
+			case "$push":
+				cur, _ := lookup(doc, path)
+				arr, _ := cur.(bson.A)
+				err = setPath(doc, path, append(arr, value))
+			case "$addToSet":
+				cur, _ := lookup(doc, path)
+				arr, _ := cur.(bson.A)
+				if !eqMatch(arr, true, value) {
+					arr = append(arr, value)
+				}
+				err = setPath(doc, path, arr)
+			default:
+				return fmt.Errorf("mongotest: unsupported update operator %s", op)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func upsertDoc(filter bson.M, update bson.M) (bson.M, error) {
+	doc := bson.M{}
+	if !isReplacement(update) {
+		for k, v := range filter {
+			if strings.HasPrefix(k, "$") {
+				continue
+			}
+
+			if ops, isOps := isOperatorDoc(v); isOps {
+				eq, ok := ops["$eq"]
+				if !ok {
+					continue
+				}
+				v = eq
+			}
+
+			err := setPath(doc, k, v)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else if id, ok := filter["_id"]; ok {
+		if _, isOps := isOperatorDoc(id); !isOps {
+			doc["_id"] = id
+		}
+	}
+
+	err := applyUpdate(doc, update, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := doc["_id"]; !ok {
+		if id, ok := filter["_id"]; ok {
+			if _, isOps := isOperatorDoc(id); !isOps {
+				doc["_id"] = id
+			}
+		}
+	}
+
+	return doc, nil
+}
+
+func sortDocs(docs []bson.M, spec interface{}) error {
+	keys, err := elements(spec)
+	if err != nil {
+		return err
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, k := range keys {
+			dir, _ := toFloat(k.Value)
+			a, aok := lookup(docs[i], k.Key)
+			b, bok := lookup(docs[j], k.Key)
+
+			var r int
+			switch {
+			case !aok && !bok:
+				r = 0
+			case !aok:
+				r = -1
+			case !bok:
+				r = 1
+			default:
+				r, _ = compare(a, b)
+			}
+
+			if r != 0 {
+				if dir < 0 {
+					return r > 0
+				}
+				return r < 0
+			}
+		}
+
+		return false
+	})
+
+	return nil
+}
+
+func project(doc bson.M, projection interface{}) (bson.M, error) {
+	fields, err := elements(projection)
+	if err != nil || len(fields) == 0 {
+		return doc, err
+	}
+
+	include := map[string]bool{}
+	inclusive := false
+	keepID := true
+	for _, f := range fields {
+		on := true
+		if n, ok := toFloat(f.Value); ok {
+			on = n != 0
+		} else if b, ok := f.Value.(bool); ok {
+			on = b
+		}
+
+		if f.Key == "_id" {
+			keepID = on
+			continue
+		}
+
+		include[f.Key] = on
+		if on {
+			inclusive = true
+		}
+	}
+
+	out := bson.M{}
+	for k, v := range doc {
+		if k == "_id" {
+			if keepID {
+				out[k] = v
+			}
+			continue
+		}
+
+		on, listed := include[k]
+		if (inclusive && listed && on) || (!inclusive && !listed) {
+			out[k] = v
+		}
+	}
+
+	return out, nil
+}
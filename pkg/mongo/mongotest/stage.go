@@ -0,0 +1,511 @@
+package mongotest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type collSource func(coll string) []bson.M
+
+func unsupportedStage(name string) error {
+	return fmt.Errorf("mongotest: unsupported aggregation stage %s: %w", name, ErrUnsupported)
+}
+
+func unsupportedExpr(expr string) error {
+	return fmt.Errorf("mongotest: unsupported aggregation expression %s: %w", expr, ErrUnsupported)
+}
+
+func applyPipeline(docs []bson.M, stages []bson.Raw, from collSource) ([]bson.M, error) {
+	var err error
+	for _, stage := range stages {
+		docs, err = applyStage(docs, stage, from)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return docs, nil
+}
+
+func applyStage(docs []bson.M, stage bson.Raw, from collSource) ([]bson.M, error) {
+	elems, err := stage.Elements()
+	if err != nil || len(elems) != 1 {
+		return nil, fmt.Errorf("mongotest: invalid aggregation stage")
+	}
+
+	name, value := elems[0].Key(), elems[0].Value()
+	switch name {
+	case "$match":
+		filter := bson.M{}
+		err = value.Unmarshal(&filter)
+		if err != nil {
+			return nil, err
+		}
+
+		out := []bson.M{}
+		for _, d := range docs {
+			ok, err := match(d, filter)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				out = append(out, d)
+			}
+		}
+		return out, nil
+	case "$sort":
+		return docs, sortDocs(docs, value.Document())
+	case "$skip", "$limit":
+		n, ok := value.AsInt64OK()
+		if !ok {
+			return nil, fmt.Errorf("mongotest: %s requires a number", name)
+		}
+		if n > int64(len(docs)) {
+			n = int64(len(docs))
+		}
+		if name == "$skip" {
+			return docs[n:], nil
+		}
+		return docs[:n], nil
+	case "$project":
+		out := []bson.M{}
+		for _, d := range docs {
+			p, err := project(d, value.Document())
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, p)
+		}
+		return out, nil
+	case "$count":
+		field, ok := value.StringValueOK()
+		if !ok {
+			return nil, fmt.Errorf("mongotest: $count requires a field name")
+		}
+		return []bson.M{{field: int32(len(docs))}}, nil
+	case "$group":
+		spec := bson.D{}
+		err = value.Unmarshal(&spec)
+		if err != nil {
+			return nil, err
+		}
+		return group(docs, spec)
+	case "$unwind":
+		return unwind(docs, value)
+	case "$lookup":
+		spec := bson.M{}
+		err = value.Unmarshal(&spec)
+		if err != nil {
+			return nil, err
+		}
+		return lookupStage(docs, spec, from)
+	case "$facet":
+		return facet(docs, value, from)
+	}
+
+	return nil, unsupportedStage(name)
+}
+
+func fieldPath(v interface{}) (string, bool) {
+	s, ok := v.(string)
+	if !ok || !strings.HasPrefix(s, "$") || strings.HasPrefix(s, "$$") {
+		return "", false
+	}
+
+	return s[1:], true
+}
+
+func evalExpr(doc bson.M, expr interface{}) (interface{}, error) {
+	switch e := expr.(type) {
+	case string:
+		if strings.HasPrefix(e, "$$") {
+			return nil, unsupportedExpr(e)
+		}
+		if path, ok := fieldPath(e); ok {
+			v, _ := lookup(doc, path)
+			return v, nil
+		}
+		return e, nil
+	case bson.D:
+		if len(e) > 0 && strings.HasPrefix(e[0].Key, "$") {
+			return nil, unsupportedExpr(e[0].Key)
+		}
+
+		out := bson.D{}
+		for _, f := range e {
+			v, err := evalExpr(doc, f.Value)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, bson.E{Key: f.Key, Value: v})
+		}
+		return out, nil
+	case bson.M:
+		keys := []string{}
+		for k := range e {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		d := bson.D{}
+		for _, k := range keys {
+			d = append(d, bson.E{Key: k, Value: e[k]})
+		}
+		return evalExpr(doc, d)
+	case bson.A:
+		out := bson.A{}
+		for _, item := range e {
+			v, err := evalExpr(doc, item)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	}
+
+	return expr, nil
+}
+
+func groupKey(v interface{}) (string, error) {
+	b, err := bson.Marshal(bson.D{{Key: "k", Value: v}})
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+type accumulator struct {
+	op     string
+	expr   interface{}
+	values []interface{}
+}
+
+func (a *accumulator) add(doc bson.M) error {
+	if a.op == "$count" {
+		a.values = append(a.values, nil)
+		return nil
+	}
+
+	v, err := evalExpr(doc, a.expr)
+	if err != nil {
+		return err
+	}
+
+	a.values = append(a.values, v)
+	return nil
+}
+
+func (a *accumulator) result() (interface{}, error) {
+	switch a.op {
+	case "$count":
+		return int32(len(a.values)), nil
+	case "$sum":
+		var sum int64
+		var fsum float64
+		isFloat := false
+		for _, v := range a.values {
+			switch n := v.(type) {
+			case int32:
+				sum += int64(n)
+			case int64:
+				sum += n
+			case float64:
+				fsum += n
+				isFloat = true
+			}
+		}
+		if isFloat {
+			return fsum + float64(sum), nil
+		}
+		return sum, nil
+	case "$avg":
+		var total float64
+		n := 0
+		for _, v := range a.values {
+			f, ok := toFloat(v)
+			if ok {
+				total += f
+				n++
+			}
+		}
+		if n == 0 {
+			return nil, nil
+		}
+		return total / float64(n), nil
+	case "$min", "$max":
+		var best interface{}
+		for _, v := range a.values {
+			if v == nil {
+				continue
+			}
+			if best == nil {
+				best = v
+				continue
+			}
+			c, ok := compare(v, best)
+			if ok && ((a.op == "$min" && c < 0) || (a.op == "$max" && c > 0)) {
+				best = v
+			}
+		}
+		return best, nil
+	case "$first":
+		if len(a.values) == 0 {
+			return nil, nil
+		}
+		return a.values[0], nil
+	case "$last":
+		if len(a.values) == 0 {
+			return nil, nil
+		}
+		return a.values[len(a.values)-1], nil
+	case "$push":
+		return bson.A(append([]interface{}{}, a.values...)), nil
+	case "$addToSet":
+		set := bson.A{}
+		for _, v := range a.values {
+			seen := false
+			for _, s := range set {
+				if equal(s, v) {
+					seen = true
+					break
+				}
+			}
+			if !seen {
+				set = append(set, v)
+			}
+		}
+		return set, nil
+	}
+
+	return nil, unsupportedExpr(a.op)
+}
+
+func newAccumulator(field string, spec interface{}) (*accumulator, error) {
+	d, ok := spec.(bson.D)
+	if !ok || len(d) != 1 {
+		return nil, fmt.Errorf("mongotest: $group field %s must be a single accumulator", field)
+	}
+
+	switch d[0].Key {
+	case "$count", "$sum", "$avg", "$min", "$max", "$first", "$last", "$push", "$addToSet":
+		return &accumulator{op: d[0].Key, expr: d[0].Value}, nil
+	}
+
+	return nil, unsupportedExpr(d[0].Key)
+}
+
+func group(docs []bson.M, spec bson.D) ([]bson.M, error) {
+	var idExpr interface{}
+	fields := bson.D{}
+	for _, e := range spec {
+		if e.Key == "_id" {
+			idExpr = e.Value
+			continue
+		}
+		fields = append(fields, e)
+	}
+
+	type bucket struct {
+		id   interface{}
+		accs []*accumulator
+	}
+
+	keys := []string{}
+	buckets := map[string]*bucket{}
+	for _, doc := range docs {
+		id, err := evalExpr(doc, idExpr)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := groupKey(id)
+		if err != nil {
+			return nil, err
+		}
+
+		b, ok := buckets[key]
+		if !ok {
+			b = &bucket{id: id}
+			for _, f := range fields {
+				acc, err := newAccumulator(f.Key, f.Value)
+				if err != nil {
+					return nil, err
+				}
+				b.accs = append(b.accs, acc)
+			}
+			buckets[key] = b
+			keys = append(keys, key)
+		}
+
+		for _, acc := range b.accs {
+			err = acc.add(doc)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	out := []bson.M{}
+	for _, key := range keys {
+		b := buckets[key]
+		doc := bson.M{"_id": b.id}
+		for i, f := range fields {
+			v, err := b.accs[i].result()
+			if err != nil {
+				return nil, err
+			}
+			doc[f.Key] = v
+		}
+		out = append(out, doc)
+	}
+
+	return out, nil
+}
+
+func unwind(docs []bson.M, value bson.RawValue) ([]bson.M, error) {
+	spec := bson.M{}
+	if path, ok := value.StringValueOK(); ok {
+		spec["path"] = path
+	} else {
+		err := value.Unmarshal(&spec)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := spec["includeArrayIndex"]; ok {
+		return nil, unsupportedExpr("$unwind.includeArrayIndex")
+	}
+
+	path, ok := fieldPath(spec["path"])
+	if !ok {
+		return nil, fmt.Errorf("mongotest: $unwind path must be a field path, got %v", spec["path"])
+	}
+	preserve, _ := spec["preserveNullAndEmptyArrays"].(bool)
+
+	out := []bson.M{}
+	for _, doc := range docs {
+		v, exists := lookup(doc, path)
+		items, isArray := v.(bson.A)
+		if !isArray {
+			if raw, ok := v.([]interface{}); ok {
+				items, isArray = bson.A(raw), true
+			}
+		}
+
+		switch {
+		case isArray && len(items) > 0:
+			for _, item := range items {
+				d := clone(doc)
+				err := setPath(d, path, deepCopy(item))
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, d)
+			}
+		case exists && v != nil && !isArray:
+			out = append(out, doc)
+		case preserve:
+			d := clone(doc)
+			if isArray {
+				unsetPath(d, path)
+			}
+			out = append(out, d)
+		}
+	}
+
+	return out, nil
+}
+
+func lookupStage(docs []bson.M, spec bson.M, from collSource) ([]bson.M, error) {
+	if _, ok := spec["pipeline"]; ok {
+		return nil, unsupportedExpr("$lookup.pipeline")
+	}
+
+	coll, _ := spec["from"].(string)
+	local, _ := spec["localField"].(string)
+	foreign, _ := spec["foreignField"].(string)
+	as, _ := spec["as"].(string)
+	if coll == "" || local == "" || foreign == "" || as == "" {
+		return nil, fmt.Errorf("mongotest: $lookup requires from, localField, foreignField and as")
+	}
+
+	foreignDocs := from(coll)
+	out := []bson.M{}
+	for _, doc := range docs {
+		lv, _ := lookup(doc, local)
+		joined := bson.A{}
+		for _, fd := range foreignDocs {
+			fv, _ := lookup(fd, foreign)
+			if eqMatch(fv, fv != nil, lv) || eqMatch(lv, lv != nil, fv) {
+				joined = append(joined, clone(fd))
+			}
+		}
+
+		d := clone(doc)
+		err := setPath(d, as, joined)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+
+	return out, nil
+}
+
+func facet(docs []bson.M, value bson.RawValue, from collSource) ([]bson.M, error) {
+	facets, ok := value.DocumentOK()
+	if !ok {
+		return nil, fmt.Errorf("mongotest: $facet requires a document")
+	}
+
+	elems, err := facets.Elements()
+	if err != nil {
+		return nil, err
+	}
+
+	result := bson.M{}
+	for _, e := range elems {
+		arr, ok := e.Value().ArrayOK()
+		if !ok {
+			return nil, fmt.Errorf("mongotest: $facet %s requires a pipeline", e.Key())
+		}
+
+		values, err := arr.Values()
+		if err != nil {
+			return nil, err
+		}
+
+		stages := []bson.Raw{}
+		for _, v := range values {
+			stage, ok := v.DocumentOK()
+			if !ok {
+				return nil, fmt.Errorf("mongotest: $facet %s has an invalid stage", e.Key())
+			}
+			stages = append(stages, stage)
+		}
+
+		input := make([]bson.M, len(docs))
+		for i, d := range docs {
+			input[i] = clone(d)
+		}
+
+		out, err := applyPipeline(input, stages, from)
+		if err != nil {
+			return nil, err
+		}
+
+		items := bson.A{}
+		for _, d := range out {
+			items = append(items, d)
+		}
+		result[e.Key()] = items
+	}
+
+	return []bson.M{result}, nil
+}
@@ -0,0 +1,219 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	log "go-micro.dev/v5/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+const (
+	redactedValue = "?"
+)
+
+type Metrics interface {
+	ObserveCommand(db, coll, command string, duration time.Duration, err error)
+	SetPoolConnections(address string, open, inUse int64)
+}
+
+type startedCommand struct {
+	db      string
+	coll    string
+	command bson.Raw
+}
+
+type poolStats struct {
+	open  int64
+	inUse int64
+}
+
+func (m Monitoring) enabled() bool {
+	return m.SlowThreshold > 0 || m.Metrics != nil || m.CommandMonitor != nil || m.PoolMonitor != nil
+}
+
+func commandColl(cmd bson.Raw) string {
+	elems, err := cmd.Elements()
+	if err != nil || len(elems) == 0 {
+		return ""
+	}
+
+	coll, ok := elems[0].Value().StringValueOK()
+	if ok {
+		return coll
+	}
+
+	coll, _ = cmd.Lookup("collection").StringValueOK()
+	return coll
+}
+
+func redact(cmd bson.Raw) bson.D {
+	return redactDoc(cmd, true)
+}
+
+func redactDoc(cmd bson.Raw, top bool) bson.D {
+	elems, err := cmd.Elements()
+	if err != nil {
+		return nil
+	}
+
+	d := bson.D{}
+	for i, e := range elems {
+		key := e.Key()
+		if top && (strings.HasPrefix(key, "$") || key == "lsid" || key == "txnNumber") {
+			continue
+		}
+
+		if top && i == 0 {
+			d = append(d, bson.E{Key: key, Value: e.Value()})
+			continue
+		}
+
+		d = append(d, bson.E{Key: key, Value: redactValue(e.Value())})
+	}
+
+	return d
+}
+
+func redactValue(v bson.RawValue) interface{} {
+	switch v.Type {
+	case bsontype.EmbeddedDocument:
+		return redactDoc(v.Document(), false)
+	case bsontype.Array:
+		values, err := v.Array().Values()
+		if err != nil {
+			return redactedValue
+		}
+
+		a := bson.A{}
+		for _, av := range values {
+			a = append(a, redactValue(av))
+		}
+		return a
+	}
+
+	return redactedValue
+}
+
+func (h *Helper) formatCommand(cmd bson.Raw) string {
+	var doc interface{} = redact(cmd)
+	if h.Monitoring.ShowFilters {
+		doc = cmd
+	}
+
+	b, err := bson.MarshalExtJSON(doc, false, false)
+	if err != nil {
+		return ""
+	}
+
+	return string(b)
+}
+
+func (h *Helper) newCommandMonitor() *event.CommandMonitor {
+	started := sync.Map{}
+	user := h.Monitoring.CommandMonitor
+
+	finish := func(requestID int64, name string, d time.Duration, err error) {
+		v, ok := started.LoadAndDelete(requestID)
+		if !ok {
+			return
+		}
+
+		s := v.(startedCommand)
+		if h.Monitoring.Metrics != nil {
+			h.Monitoring.Metrics.ObserveCommand(s.db, s.coll, name, d, err)
+		}
+
+		if h.Monitoring.SlowThreshold > 0 && d >= h.Monitoring.SlowThreshold.Std() {
+			log.Warnf(
+				"slow mongo command %s on %s.%s took %s: %s",
+				name,
+				s.db,
+				s.coll,
+				d,
+				h.formatCommand(s.command),
+			)
+		}
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			s := startedCommand{
+				db:   e.DatabaseName,
+				coll: commandColl(e.Command),
+			}
+			if h.Monitoring.SlowThreshold > 0 {
+				s.command = append(bson.Raw(nil), e.Command...)
+			}
+			started.Store(e.RequestID, s)
+
+			if user != nil && user.Started != nil {
+				user.Started(ctx, e)
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			finish(e.RequestID, e.CommandName, e.Duration, nil)
+
+			if user != nil && user.Succeeded != nil {
+				user.Succeeded(ctx, e)
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			finish(e.RequestID, e.CommandName, e.Duration, errors.New(e.Failure))
+
+			if user != nil && user.Failed != nil {
+				user.Failed(ctx, e)
+			}
+		},
+	}
+}
+
+func (h *Helper) newPoolMonitor() *event.PoolMonitor {
+	mu := sync.Mutex{}
+	stats := map[string]*poolStats{}
+	user := h.Monitoring.PoolMonitor
+
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			if h.Monitoring.Metrics != nil {
+				mu.Lock()
+				s, ok := stats[e.Address]
+				if !ok {
+					s = &poolStats{}
+					stats[e.Address] = s
+				}
+
+				changed := true
+				switch e.Type {
+				case event.ConnectionCreated:
+					s.open++
+				case event.ConnectionClosed:
+					s.open--
+				case event.GetSucceeded:
+					s.inUse++
+				case event.ConnectionReturned:
+					s.inUse--
+				case event.PoolClosedEvent:
+					s.open, s.inUse = 0, 0
+				default:
+					changed = false
+				}
+				open, inUse := s.open, s.inUse
+				mu.Unlock()
+
+				if changed {
+					h.Monitoring.Metrics.SetPoolConnections(e.Address, open, inUse)
+				}
+			}
+
+			if user != nil && user.Event != nil {
+				user.Event(e)
+			}
+		},
+	}
+}
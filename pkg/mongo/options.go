@@ -1,5 +1,49 @@
 package mongo
 
+import (
+	"time"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/duration"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+const (
+	defaultTimeout = duration.Duration(5 * time.Second)
+
+	defaultTxnMaxRetries = 3
+	defaultTxnBackoff    = duration.Duration(100 * time.Millisecond)
+	defaultTxnMaxBackoff = duration.Duration(2 * time.Second)
+
+	defaultWatchTokenCollection = "_resumeTokens"
+	defaultWatchConcurrency     = 1
+	defaultWatchBackoff         = duration.Duration(500 * time.Millisecond)
+	defaultWatchMaxBackoff      = duration.Duration(30 * time.Second)
+
+	defaultMigrationCollection = "_migrations"
+	defaultMigrationLeaseTTL   = duration.Duration(time.Minute)
+
+	defaultBulkBatchSize = 1000
+	defaultBulkOrdered   = true
+
+	defaultHealthInterval = duration.Duration(10 * time.Second)
+
+	defaultLeaseCollection = "_locks"
+	defaultLeaseTTL        = duration.Duration(30 * time.Second)
+
+	defaultAuditCreatedAt = "createdAt"
+	defaultAuditUpdatedAt = "updatedAt"
+	defaultAuditDeletedAt = "deletedAt"
+	defaultAuditCreatedBy = "createdBy"
+
+	ConnectAutomatic  = "automatic"
+	ConnectDirect     = "direct"
+	ConnectReplicaSet = "replicaSet"
+
+	AuthMechanismScramSha1   = "SCRAM-SHA-1"
+	AuthMechanismScramSha256 = "SCRAM-SHA-256"
+	AuthMechanismX509        = "MONGODB-X509"
+)
+
 var (
 	Opts *Options
 )
@@ -12,17 +56,122 @@ type Options struct {
 	ReplicaSet string `json:"replicaSet" yaml:"replicaSet"`
 	Connect    string `json:"connect" yaml:"connect"`
 
+	Tls                    `json:"tls" yaml:"tls"`
+	ReadPreference         string `json:"readPreference" yaml:"readPreference"`
+	Pool                   `json:"pool" yaml:"pool"`
+	ConnectTimeout         duration.Duration `json:"connectTimeout" yaml:"connectTimeout"`
+	ServerSelectionTimeout duration.Duration `json:"serverSelectionTimeout" yaml:"serverSelectionTimeout"`
+	SocketTimeout          duration.Duration `json:"socketTimeout" yaml:"socketTimeout"`
+
+	Timeout    duration.Duration `json:"timeout" yaml:"timeout"`
+	Txn        `json:"txn" yaml:"txn"`
+	Watcher    `json:"watcher" yaml:"watcher"`
+	Migration  `json:"migration" yaml:"migration"`
+	BulkWrite  `json:"bulkWrite" yaml:"bulkWrite"`
+	Health     `json:"health" yaml:"health"`
+	Monitoring `json:"monitoring" yaml:"monitoring"`
+	Audit      `json:"audit" yaml:"audit"`
+	Lease      `json:"lease" yaml:"lease"`
+	Encryption `json:"encryption" yaml:"encryption"`
+
 	Database    string            `json:"database" yaml:"database"`
 	Collection  string            `json:"collection" yaml:"collection"`
 	Databases   map[string]string `json:"databases" yaml:"databases"`
 	Collections map[string]string `json:"collections" yaml:"collections"`
 }
 
+type Tls struct {
+	Enable             bool   `json:"enable" yaml:"enable"`
+	CaFile             string `json:"caFile" yaml:"caFile"`
+	CertFile           string `json:"certFile" yaml:"certFile"`
+	KeyFile            string `json:"keyFile" yaml:"keyFile"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify" yaml:"insecureSkipVerify"`
+}
+
+type Pool struct {
+	MaxSize     uint64            `json:"maxSize" yaml:"maxSize"`
+	MinSize     uint64            `json:"minSize" yaml:"minSize"`
+	MaxIdleTime duration.Duration `json:"maxIdleTime" yaml:"maxIdleTime"`
+}
+
+type Txn struct {
+	ReadConcern  string            `json:"readConcern" yaml:"readConcern"`
+	WriteConcern string            `json:"writeConcern" yaml:"writeConcern"`
+	MaxRetries   int               `json:"maxRetries" yaml:"maxRetries"`
+	Backoff      duration.Duration `json:"backoff" yaml:"backoff"`
+	MaxBackoff   duration.Duration `json:"maxBackoff" yaml:"maxBackoff"`
+}
+
+type Watcher struct {
+	TokenDatabase   string            `json:"tokenDatabase" yaml:"tokenDatabase"`
+	TokenCollection string            `json:"tokenCollection" yaml:"tokenCollection"`
+	Concurrency     int               `json:"concurrency" yaml:"concurrency"`
+	Backoff         duration.Duration `json:"backoff" yaml:"backoff"`
+	MaxBackoff      duration.Duration `json:"maxBackoff" yaml:"maxBackoff"`
+}
+
+type Migration struct {
+	Collection string            `json:"collection" yaml:"collection"`
+	LeaseTTL   duration.Duration `json:"leaseTTL" yaml:"leaseTTL"`
+}
+
+type BulkWrite struct {
+	BatchSize int  `json:"batchSize" yaml:"batchSize"`
+	Ordered   bool `json:"ordered" yaml:"ordered"`
+}
+
+type Health struct {
+	PingOnConnect bool              `json:"pingOnConnect" yaml:"pingOnConnect"`
+	Interval      duration.Duration `json:"interval" yaml:"interval"`
+}
+
+type Monitoring struct {
+	SlowThreshold duration.Duration `json:"slowThreshold" yaml:"slowThreshold"`
+	ShowFilters   bool              `json:"showFilters" yaml:"showFilters"`
+
+	Metrics        Metrics               `json:"-" yaml:"-"`
+	CommandMonitor *event.CommandMonitor `json:"-" yaml:"-"`
+	PoolMonitor    *event.PoolMonitor    `json:"-" yaml:"-"`
+}
+
+type Lease struct {
+	Database      string            `json:"database" yaml:"database"`
+	Collection    string            `json:"collection" yaml:"collection"`
+	TTL           duration.Duration `json:"ttl" yaml:"ttl"`
+	RenewInterval duration.Duration `json:"renewInterval" yaml:"renewInterval"`
+}
+
+type Encryption struct {
+	CurrentKey string              `json:"currentKey" yaml:"currentKey"`
+	Keys       map[string]string   `json:"keys" yaml:"keys"`
+	Fields     map[string][]string `json:"fields" yaml:"fields"`
+
+	KeyProvider KeyProvider `json:"-" yaml:"-"`
+}
+
+type Audit struct {
+	Fields   AuditFields            `json:"fields" yaml:"fields"`
+	Policies map[string]AuditPolicy `json:"policies" yaml:"policies"`
+}
+
+type AuditFields struct {
+	CreatedAt string `json:"createdAt" yaml:"createdAt"`
+	UpdatedAt string `json:"updatedAt" yaml:"updatedAt"`
+	DeletedAt string `json:"deletedAt" yaml:"deletedAt"`
+	CreatedBy string `json:"createdBy" yaml:"createdBy"`
+}
+
+type AuditPolicy struct {
+	Timestamps bool `json:"timestamps" yaml:"timestamps"`
+	SoftDelete bool `json:"softDelete" yaml:"softDelete"`
+}
+
 type Auth struct {
-	Enable   bool   `json:"enable" yaml:"enable"`
-	Source   string `json:"source" yaml:"source"`
-	Username string `json:"username" yaml:"username"`
-	Password string `json:"password" yaml:"password"`
+	Enable    bool   `json:"enable" yaml:"enable"`
+	Mechanism string `json:"mechanism" yaml:"mechanism"`
+	Source    string `json:"source" yaml:"source"`
+	Username  string `json:"username" yaml:"username"`
+	Password  string `json:"password" yaml:"password"`
 }
 
 func Uri(uri string) Option {
@@ -43,6 +192,84 @@ func Connect(connect string) Option {
 	}
 }
 
+func TlsEnable(enable bool) Option {
+	return func(o *Options) {
+		o.Tls.Enable = enable
+	}
+}
+
+func TlsCaFile(file string) Option {
+	return func(o *Options) {
+		o.Tls.CaFile = file
+	}
+}
+
+func TlsCertFile(file string) Option {
+	return func(o *Options) {
+		o.Tls.CertFile = file
+	}
+}
+
+func TlsKeyFile(file string) Option {
+	return func(o *Options) {
+		o.Tls.KeyFile = file
+	}
+}
+
+func TlsInsecureSkipVerify(skip bool) Option {
+	return func(o *Options) {
+		o.Tls.InsecureSkipVerify = skip
+	}
+}
+
+func ReadPreference(mode string) Option {
+	return func(o *Options) {
+		o.ReadPreference = mode
+	}
+}
+
+func PoolMaxSize(size uint64) Option {
+	return func(o *Options) {
+		o.Pool.MaxSize = size
+	}
+}
+
+func PoolMinSize(size uint64) Option {
+	return func(o *Options) {
+		o.Pool.MinSize = size
+	}
+}
+
+func PoolMaxIdleTime(t time.Duration) Option {
+	return func(o *Options) {
+		o.Pool.MaxIdleTime = duration.Duration(t)
+	}
+}
+
+func ConnectTimeout(t time.Duration) Option {
+	return func(o *Options) {
+		o.ConnectTimeout = duration.Duration(t)
+	}
+}
+
+func ServerSelectionTimeout(t time.Duration) Option {
+	return func(o *Options) {
+		o.ServerSelectionTimeout = duration.Duration(t)
+	}
+}
+
+func SocketTimeout(t time.Duration) Option {
+	return func(o *Options) {
+		o.SocketTimeout = duration.Duration(t)
+	}
+}
+
+func Timeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = duration.Duration(timeout)
+	}
+}
+
 func Database(database string) Option {
 	return func(o *Options) {
 		o.Database = database
@@ -73,6 +300,12 @@ func AuthEnable(enable bool) Option {
 	}
 }
 
+func AuthMechanism(mechanism string) Option {
+	return func(o *Options) {
+		o.Auth.Mechanism = mechanism
+	}
+}
+
 func AuthSource(source string) Option {
 	return func(o *Options) {
 		o.Auth.Source = source
@@ -90,3 +323,201 @@ func AuthPassword(password string) Option {
 		o.Auth.Password = password
 	}
 }
+
+func TxnReadConcern(level string) Option {
+	return func(o *Options) {
+		o.Txn.ReadConcern = level
+	}
+}
+
+func TxnWriteConcern(w string) Option {
+	return func(o *Options) {
+		o.Txn.WriteConcern = w
+	}
+}
+
+func TxnMaxRetries(retries int) Option {
+	return func(o *Options) {
+		o.Txn.MaxRetries = retries
+	}
+}
+
+func TxnBackoff(backoff time.Duration) Option {
+	return func(o *Options) {
+		o.Txn.Backoff = duration.Duration(backoff)
+	}
+}
+
+func TxnMaxBackoff(backoff time.Duration) Option {
+	return func(o *Options) {
+		o.Txn.MaxBackoff = duration.Duration(backoff)
+	}
+}
+
+func WatcherTokenDatabase(db string) Option {
+	return func(o *Options) {
+		o.Watcher.TokenDatabase = db
+	}
+}
+
+func WatcherTokenCollection(coll string) Option {
+	return func(o *Options) {
+		o.Watcher.TokenCollection = coll
+	}
+}
+
+func WatcherConcurrency(concurrency int) Option {
+	return func(o *Options) {
+		o.Watcher.Concurrency = concurrency
+	}
+}
+
+func WatcherBackoff(backoff time.Duration) Option {
+	return func(o *Options) {
+		o.Watcher.Backoff = duration.Duration(backoff)
+	}
+}
+
+func WatcherMaxBackoff(backoff time.Duration) Option {
+	return func(o *Options) {
+		o.Watcher.MaxBackoff = duration.Duration(backoff)
+	}
+}
+
+func MigrationCollection(coll string) Option {
+	return func(o *Options) {
+		o.Migration.Collection = coll
+	}
+}
+
+func MigrationLeaseTTL(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.Migration.LeaseTTL = duration.Duration(ttl)
+	}
+}
+
+func BulkBatchSize(size int) Option {
+	return func(o *Options) {
+		o.BulkWrite.BatchSize = size
+	}
+}
+
+func BulkOrdered(ordered bool) Option {
+	return func(o *Options) {
+		o.BulkWrite.Ordered = ordered
+	}
+}
+
+func HealthPingOnConnect(ping bool) Option {
+	return func(o *Options) {
+		o.Health.PingOnConnect = ping
+	}
+}
+
+func HealthInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.Health.Interval = duration.Duration(interval)
+	}
+}
+
+func MonitoringSlowThreshold(threshold time.Duration) Option {
+	return func(o *Options) {
+		o.Monitoring.SlowThreshold = duration.Duration(threshold)
+	}
+}
+
+func MonitoringShowFilters(show bool) Option {
+	return func(o *Options) {
+		o.Monitoring.ShowFilters = show
+	}
+}
+
+func MonitoringMetrics(metrics Metrics) Option {
+	return func(o *Options) {
+		o.Monitoring.Metrics = metrics
+	}
+}
+
+func MonitoringCommandMonitor(monitor *event.CommandMonitor) Option {
+	return func(o *Options) {
+		o.Monitoring.CommandMonitor = monitor
+	}
+}
+
+func MonitoringPoolMonitor(monitor *event.PoolMonitor) Option {
+	return func(o *Options) {
+		o.Monitoring.PoolMonitor = monitor
+	}
+}
+
+func AuditCollection(name string, policy AuditPolicy) Option {
+	return func(o *Options) {
+		if o.Audit.Policies == nil {
+			o.Audit.Policies = map[string]AuditPolicy{}
+		}
+		o.Audit.Policies[name] = policy
+	}
+}
+
+func AuditFieldNames(fields AuditFields) Option {
+	return func(o *Options) {
+		if fields.CreatedAt != "" {
+			o.Audit.Fields.CreatedAt = fields.CreatedAt
+		}
+		if fields.UpdatedAt != "" {
+			o.Audit.Fields.UpdatedAt = fields.UpdatedAt
+		}
+		if fields.DeletedAt != "" {
+			o.Audit.Fields.DeletedAt = fields.DeletedAt
+		}
+		if fields.CreatedBy != "" {
+			o.Audit.Fields.CreatedBy = fields.CreatedBy
+		}
+	}
+}
+
+func LeaseDatabase(db string) Option {
+	return func(o *Options) {
+		o.Lease.Database = db
+	}
+}
+
+func LeaseCollection(coll string) Option {
+	return func(o *Options) {
+		o.Lease.Collection = coll
+	}
+}
+
+func LeaseTTL(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.Lease.TTL = duration.Duration(ttl)
+	}
+}
+
+func LeaseRenewInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.Lease.RenewInterval = duration.Duration(interval)
+	}
+}
+
+func EncryptionKeys(current string, keys map[string]string) Option {
+	return func(o *Options) {
+		o.Encryption.CurrentKey = current
+		o.Encryption.Keys = keys
+	}
+}
+
+func EncryptionKeyProvider(provider KeyProvider) Option {
+	return func(o *Options) {
+		o.Encryption.KeyProvider = provider
+	}
+}
+
+func EncryptFields(name string, fields ...string) Option {
+	return func(o *Options) {
+		if o.Encryption.Fields == nil {
+			o.Encryption.Fields = map[string][]string{}
+		}
+		o.Encryption.Fields[name] = append(o.Encryption.Fields[name], fields...)
+	}
+}
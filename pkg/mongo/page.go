@@ -0,0 +1,261 @@
+package mongo
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+const (
+	defaultPageLimit = 50
+)
+
+type PageRequest struct {
+	SortField  string `json:"sortField" yaml:"sortField"`
+	Descending bool   `json:"descending" yaml:"descending"`
+	After      string `json:"after" yaml:"after"`
+	Limit      int64  `json:"limit" yaml:"limit"`
+}
+
+type PageResult struct {
+	Items   []bson.Raw `json:"-"`
+	Next    string     `json:"next"`
+	HasMore bool       `json:"hasMore"`
+}
+
+type pageToken struct {
+	Field      string        `bson:"f"`
+	Descending bool          `bson:"d"`
+	Value      bson.RawValue `bson:"v,omitempty"`
+	ID         bson.RawValue `bson:"id"`
+}
+
+func (r PageRequest) field() string {
+	if r.SortField == "" {
+		return "_id"
+	}
+
+	return r.SortField
+}
+
+func (r PageRequest) limit() int64 {
+	if r.Limit <= 0 {
+		return defaultPageLimit
+	}
+
+	return r.Limit
+}
+
+func encodePageToken(t pageToken) (string, error) {
+	b, err := bson.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodePageToken(s string) (*pageToken, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page token: %s", err.Error())
+	}
+
+	t := &pageToken{}
+	err = bson.Unmarshal(b, t)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page token: %s", err.Error())
+	}
+
+	return t, nil
+}
+
+func (r PageRequest) filter(filter bson.M) (bson.M, error) {
+	if r.After == "" {
+		return filter, nil
+	}
+
+	t, err := decodePageToken(r.After)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Field != r.field() || t.Descending != r.Descending {
+		return nil, fmt.Errorf(
+			"page token does not match request. values: field(%s); descending(%t)",
+			r.field(),
+			r.Descending,
+		)
+	}
+
+	op := "$gt"
+	if r.Descending {
+		op = "$lt"
+	}
+
+	keyset := r.keyset(op, t)
+
+	if len(filter) == 0 {
+		return keyset, nil
+	}
+
+	return bson.M{"$and": bson.A{filter, keyset}}, nil
+}
+
+// keyset matches the documents after the token. Missing and null sort values
+// are equal and order before any other value, so they need their own branches:
+// $gt and $lt never match null.
+func (r PageRequest) keyset(op string, t *pageToken) bson.M {
+	f := r.field()
+	if f == "_id" {
+		return bson.M{"_id": bson.M{op: t.ID}}
+	}
+
+	null := t.Value.Type == 0 || t.Value.Type == bson.TypeNull
+	switch {
+	case null && r.Descending:
+		return bson.M{f: nil, "_id": bson.M{op: t.ID}}
+	case null:
+		return bson.M{"$or": bson.A{
+			bson.M{f: bson.M{"$ne": nil}},
+			bson.M{f: nil, "_id": bson.M{op: t.ID}},
+		}}
+	case r.Descending:
+		return bson.M{"$or": bson.A{
+			bson.M{f: bson.M{op: t.Value}},
+			bson.M{f: t.Value, "_id": bson.M{op: t.ID}},
+			bson.M{f: nil},
+		}}
+	}
+
+	return bson.M{"$or": bson.A{
+		bson.M{f: bson.M{op: t.Value}},
+		bson.M{f: t.Value, "_id": bson.M{op: t.ID}},
+	}}
+}
+
+func (r PageRequest) sort() bson.D {
+	dir := 1
+	if r.Descending {
+		dir = -1
+	}
+
+	if r.field() == "_id" {
+		return bson.D{{Key: "_id", Value: dir}}
+	}
+
+	return bson.D{
+		{Key: r.field(), Value: dir},
+		{Key: "_id", Value: dir},
+	}
+}
+
+func (r PageRequest) next(last bson.Raw) (string, error) {
+	id, err := last.LookupErr("_id")
+	if err != nil {
+		return "", fmt.Errorf("document has no _id: %s", err.Error())
+	}
+
+	t := pageToken{Field: r.field(), Descending: r.Descending, ID: id}
+	if r.field() != "_id" {
+		t.Value, err = last.LookupErr(strings.Split(r.field(), ".")...)
+		if errors.Is(err, bsoncore.ErrElementNotFound) {
+			t.Value, err = bson.RawValue{Type: bson.TypeNull}, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("document has no sort field %s: %s", r.field(), err.Error())
+		}
+	}
+
+	return encodePageToken(t)
+}
+
+func (h *Helper) Page(ctx context.Context, db, coll string, filter bson.M, req PageRequest) (*PageResult, error) {
+	c, err := h.NewCollCli(db, coll)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := req.filter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	scoped, err := h.scopeFilter(ctx, db, coll, query)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := h.withTimeout(ctx)
+	defer cancel()
+
+	opts := options.Find().SetSort(req.sort()).SetLimit(req.limit() + 1)
+	cursor, err := c.Find(ctx, scoped, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []bson.Raw{}
+	err = cursor.All(ctx, &items)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PageResult{Items: items}
+	if int64(len(items)) > req.limit() {
+		result.Items = items[:req.limit()]
+		result.HasMore = true
+	}
+
+	if result.HasMore {
+		result.Next, err = req.next(result.Items[len(result.Items)-1])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, item := range result.Items {
+		result.Items[i], err = h.Decrypt(db, coll, item)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func (p *PageResult) Decode(v interface{}) error {
+	docs := make([]interface{}, len(p.Items))
+	for i, item := range p.Items {
+		docs[i] = item
+	}
+
+	cursor, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	return cursor.All(context.Background(), v)
+}
+
+func (r *Repository[T]) Page(ctx context.Context, filter bson.M, req PageRequest) ([]T, string, error) {
+	page, err := r.helper.Page(ctx, r.DB, r.Coll, filter, req)
+	if err != nil {
+		return nil, "", err
+	}
+
+	items := []T{}
+	err = page.Decode(&items)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return items, page.Next, nil
+}
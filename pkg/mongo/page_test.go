@@ -0,0 +1,134 @@
+package mongo_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type ranked struct {
+	ID   string `bson:"_id"`
+	Rank *int   `bson:"rank,omitempty"`
+}
+
+func rank(n int) *int {
+	return &n
+}
+
+func pageAll(t *testing.T, repo *mongo.Repository[ranked], req mongo.PageRequest) []string {
+	t.Helper()
+
+	ids := []string{}
+	for i := 0; i < 10; i++ {
+		items, next, err := repo.Page(context.Background(), bson.M{}, req)
+		if err != nil {
+			t.Fatalf("page failed: %s", err.Error())
+		}
+
+		for _, item := range items {
+			ids = append(ids, item.ID)
+		}
+
+		if next == "" {
+			return ids
+		}
+		req.After = next
+	}
+
+	t.Fatalf("paging did not finish, got %v", ids)
+	return nil
+}
+
+func TestPage(t *testing.T) {
+	h, f := newHelper(t)
+	repo, err := mongo.NewRepository[ranked](h, testDB, "ranked")
+	if err != nil {
+		t.Fatalf("failed to create repository: %s", err.Error())
+	}
+
+	err = f.Seed(testDB, "ranked",
+		ranked{ID: "a", Rank: rank(2)},
+		ranked{ID: "b"},
+		ranked{ID: "c", Rank: rank(1)},
+		ranked{ID: "d", Rank: rank(2)},
+		ranked{ID: "e"},
+	)
+	if err != nil {
+		t.Fatalf("seed failed: %s", err.Error())
+	}
+
+	tests := []struct {
+		name string
+		req  mongo.PageRequest
+		want []string
+	}{
+		{
+			name: "by id",
+			req:  mongo.PageRequest{Limit: 2},
+			want: []string{"a", "b", "c", "d", "e"},
+		},
+		{
+			name: "by id descending",
+			req:  mongo.PageRequest{Limit: 2, Descending: true},
+			want: []string{"e", "d", "c", "b", "a"},
+		},
+		{
+			name: "missing sort values first",
+			req:  mongo.PageRequest{SortField: "rank", Limit: 1},
+			want: []string{"b", "e", "c", "a", "d"},
+		},
+		{
+			name: "missing sort values last when descending",
+			req:  mongo.PageRequest{SortField: "rank", Limit: 2, Descending: true},
+			want: []string{"d", "a", "c", "e", "b"},
+		},
+		{
+			name: "single page",
+			req:  mongo.PageRequest{SortField: "rank"},
+			want: []string{"b", "e", "c", "a", "d"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pageAll(t, repo, tt.req)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPageTokenMismatch(t *testing.T) {
+	h, f := newHelper(t)
+	repo, err := mongo.NewRepository[ranked](h, testDB, "ranked")
+	if err != nil {
+		t.Fatalf("failed to create repository: %s", err.Error())
+	}
+
+	err = f.Seed(testDB, "ranked", ranked{ID: "a"}, ranked{ID: "b"})
+	if err != nil {
+		t.Fatalf("seed failed: %s", err.Error())
+	}
+
+	_, next, err := repo.Page(context.Background(), bson.M{}, mongo.PageRequest{Limit: 1})
+	if err != nil {
+		t.Fatalf("page failed: %s", err.Error())
+	}
+
+	tests := []mongo.PageRequest{
+		{SortField: "rank", After: next},
+		{Descending: true, After: next},
+		{After: "not a token"},
+	}
+
+	for _, req := range tests {
+		_, _, err = repo.Page(context.Background(), bson.M{}, req)
+		if err == nil {
+			t.Errorf("expected error for %+v", req)
+		}
+	}
+}
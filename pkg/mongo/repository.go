@@ -0,0 +1,240 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrNotFound = errors.New("document not found")
+)
+
+type Paging struct {
+	Skip  int64       `json:"skip" yaml:"skip"`
+	Limit int64       `json:"limit" yaml:"limit"`
+	Sort  interface{} `json:"sort" yaml:"sort"`
+}
+
+type Repository[T any] struct {
+	helper *Helper
+	DB     string
+	Coll   string
+}
+
+func NewRepository[T any](h *Helper, db, coll string) (*Repository[T], error) {
+	if h == nil {
+		return nil, fmt.Errorf("helper is nil")
+	}
+
+	if db == "" || coll == "" {
+		return nil, fmt.Errorf(
+			"db or coll is nil or both are nil. values: db(%s); coll(%s)",
+			db,
+			coll,
+		)
+	}
+
+	err := h.learnSecure(db, coll, reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Repository[T]{helper: h, DB: db, Coll: coll}, nil
+}
+
+func NewNamedRepository[T any](h *Helper, name string) (*Repository[T], error) {
+	if h == nil {
+		return nil, fmt.Errorf("helper is nil")
+	}
+
+	db, coll, err := h.Resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRepository[T](h, db, coll)
+}
+
+func mapNotFound(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+func (r *Repository[T]) FindOne(ctx context.Context, filter interface{}) (T, error) {
+	var doc T
+	c, err := r.helper.NewCollCli(r.DB, r.Coll)
+	if err != nil {
+		return doc, err
+	}
+
+	filter, err = r.helper.scopeFilter(ctx, r.DB, r.Coll, filter)
+	if err != nil {
+		return doc, err
+	}
+
+	ctx, cancel := r.helper.withTimeout(ctx)
+	defer cancel()
+	raw, err := c.FindOne(ctx, filter).Raw()
+	if err != nil {
+		return doc, mapNotFound(err)
+	}
+
+	err = r.helper.decode(r.DB, r.Coll, raw, &doc)
+	if err != nil {
+		return doc, err
+	}
+
+	return doc, nil
+}
+
+func (r *Repository[T]) FindMany(ctx context.Context, filter interface{}, paging Paging) ([]T, error) {
+	c, err := r.helper.NewCollCli(r.DB, r.Coll)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err = r.helper.scopeFilter(ctx, r.DB, r.Coll, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find()
+	if paging.Skip > 0 {
+		opts.SetSkip(paging.Skip)
+	}
+	if paging.Limit > 0 {
+		opts.SetLimit(paging.Limit)
+	}
+	if paging.Sort != nil {
+		opts.SetSort(paging.Sort)
+	}
+
+	ctx, cancel := r.helper.withTimeout(ctx)
+	defer cancel()
+	cursor, err := c.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	raws := []bson.Raw{}
+	err = cursor.All(ctx, &raws)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]T, len(raws))
+	for i, raw := range raws {
+		err = r.helper.decode(r.DB, r.Coll, raw, &docs[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return docs, nil
+}
+
+func (r *Repository[T]) Insert(ctx context.Context, doc T) error {
+	return r.helper.InsertCtx(ctx, r.DB, r.Coll, doc)
+}
+
+func (r *Repository[T]) Upsert(ctx context.Context, filter interface{}, doc T) error {
+	return r.helper.UpdateOneCtx(ctx, r.DB, r.Coll, filter, bson.M{"$set": doc}, CreateRecordIfNotExist)
+}
+
+func (r *Repository[T]) Update(ctx context.Context, filter interface{}, update interface{}) error {
+	c, err := r.helper.NewCollCli(r.DB, r.Coll)
+	if err != nil {
+		return err
+	}
+
+	filter, err = r.helper.scopeFilter(ctx, r.DB, r.Coll, filter)
+	if err != nil {
+		return err
+	}
+
+	update, err = r.helper.encryptUpdate(r.DB, r.Coll, update)
+	if err != nil {
+		return err
+	}
+
+	update, err = r.helper.stampUpdate(ctx, r.DB, r.Coll, update)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := r.helper.withTimeout(ctx)
+	defer cancel()
+	result, err := c.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *Repository[T]) Delete(ctx context.Context, filter interface{}) error {
+	c, err := r.helper.NewCollCli(r.DB, r.Coll)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := r.helper.withTimeout(ctx)
+	defer cancel()
+	if r.helper.softDelete(r.DB, r.Coll) {
+		filter, err = r.helper.scopeFilter(ctx, r.DB, r.Coll, filter)
+		if err != nil {
+			return err
+		}
+
+		result, err := c.UpdateOne(ctx, filter, r.helper.softDeleteUpdate(r.DB, r.Coll))
+		if err != nil {
+			return err
+		}
+
+		if result.MatchedCount == 0 {
+			return ErrNotFound
+		}
+
+		return nil
+	}
+
+	result, err := c.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *Repository[T]) Count(ctx context.Context, filter interface{}) (int64, error) {
+	c, err := r.helper.NewCollCli(r.DB, r.Coll)
+	if err != nil {
+		return 0, err
+	}
+
+	filter, err = r.helper.scopeFilter(ctx, r.DB, r.Coll, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := r.helper.withTimeout(ctx)
+	defer cancel()
+	return c.CountDocuments(ctx, filter)
+}
@@ -0,0 +1,191 @@
+package mongo_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type user struct {
+	ID   string `bson:"_id"`
+	Name string `bson:"name"`
+	Age  int    `bson:"age"`
+}
+
+func newUserRepo(t *testing.T, opts ...mongo.Option) (*mongo.Repository[user], func() []bson.M) {
+	t.Helper()
+
+	h, f := newHelper(t, opts...)
+	repo, err := mongo.NewRepository[user](h, testDB, "users")
+	if err != nil {
+		t.Fatalf("failed to create repository: %s", err.Error())
+	}
+
+	err = f.Seed(testDB, "users", user{ID: "u1", Name: "alice", Age: 30}, user{ID: "u2", Name: "bob", Age: 40})
+	if err != nil {
+		t.Fatalf("seed failed: %s", err.Error())
+	}
+
+	return repo, func() []bson.M { return f.Docs(testDB, "users") }
+}
+
+func TestNewRepository(t *testing.T) {
+	h, _ := newHelper(t)
+
+	tests := []struct {
+		name string
+		h    *mongo.Helper
+		db   string
+		coll string
+	}{
+		{name: "nil helper", db: testDB, coll: "users"},
+		{name: "empty db", h: h, coll: "users"},
+		{name: "empty coll", h: h, db: testDB},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := mongo.NewRepository[user](tt.h, tt.db, tt.coll)
+			if err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
+
+func TestRepositoryNotFound(t *testing.T) {
+	ctx := context.Background()
+	repo, _ := newUserRepo(t)
+	missing := bson.M{"_id": "missing"}
+
+	tests := []struct {
+		name string
+		run  func() error
+	}{
+		{
+			name: "find one",
+			run: func() error {
+				_, err := repo.FindOne(ctx, missing)
+				return err
+			},
+		},
+		{
+			name: "update",
+			run: func() error {
+				return repo.Update(ctx, missing, bson.M{"$set": bson.M{"age": 1}})
+			},
+		},
+		{
+			name: "delete",
+			run: func() error {
+				return repo.Delete(ctx, missing)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run()
+			if !errors.Is(err, mongo.ErrNotFound) {
+				t.Errorf("expected ErrNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRepositoryCRUD(t *testing.T) {
+	ctx := context.Background()
+	repo, docs := newUserRepo(t)
+
+	err := repo.Insert(ctx, user{ID: "u3", Name: "carol", Age: 50})
+	if err != nil {
+		t.Fatalf("insert failed: %s", err.Error())
+	}
+
+	got, err := repo.FindOne(ctx, bson.M{"name": "carol"})
+	if err != nil {
+		t.Fatalf("find failed: %s", err.Error())
+	}
+	if got != (user{ID: "u3", Name: "carol", Age: 50}) {
+		t.Errorf("unexpected user %+v", got)
+	}
+
+	err = repo.Update(ctx, bson.M{"_id": "u1"}, bson.M{"$set": bson.M{"age": 31}})
+	if err != nil {
+		t.Fatalf("update failed: %s", err.Error())
+	}
+
+	many, err := repo.FindMany(ctx, bson.M{"age": bson.M{"$gt": 30}}, mongo.Paging{Sort: bson.D{{Key: "age", Value: -1}}, Limit: 2})
+	if err != nil {
+		t.Fatalf("find many failed: %s", err.Error())
+	}
+	ids := []string{}
+	for _, u := range many {
+		ids = append(ids, u.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"u3", "u2"}) {
+		t.Errorf("expected [u3 u2], got %v", ids)
+	}
+
+	err = repo.Delete(ctx, bson.M{"_id": "u2"})
+	if err != nil {
+		t.Fatalf("delete failed: %s", err.Error())
+	}
+
+	count, err := repo.Count(ctx, bson.M{})
+	if err != nil {
+		t.Fatalf("count failed: %s", err.Error())
+	}
+	if count != 2 || len(docs()) != 2 {
+		t.Errorf("expected 2 users, got %d", count)
+	}
+}
+
+func TestRepositoryUpsert(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		doc   user
+		want  user
+		count int
+	}{
+		{
+			name:  "updates existing",
+			doc:   user{ID: "u1", Name: "alice", Age: 31},
+			want:  user{ID: "u1", Name: "alice", Age: 31},
+			count: 2,
+		},
+		{
+			name:  "inserts missing",
+			doc:   user{ID: "u3", Name: "carol", Age: 50},
+			want:  user{ID: "u3", Name: "carol", Age: 50},
+			count: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, docs := newUserRepo(t)
+			err := repo.Upsert(ctx, bson.M{"_id": tt.doc.ID}, tt.doc)
+			if err != nil {
+				t.Fatalf("upsert failed: %s", err.Error())
+			}
+
+			got, err := repo.FindOne(ctx, bson.M{"_id": tt.doc.ID})
+			if err != nil {
+				t.Fatalf("find failed: %s", err.Error())
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+			if n := len(docs()); n != tt.count {
+				t.Errorf("expected %d documents, got %d", tt.count, n)
+			}
+		})
+	}
+}
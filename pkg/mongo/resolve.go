@@ -0,0 +1,59 @@
+package mongo
+
+import (
+	"fmt"
+)
+
+func (h *Helper) Resolve(name string) (string, string, error) {
+	if name == "" {
+		if h.Options.Database == "" || h.Options.Collection == "" {
+			return "", "", fmt.Errorf(
+				"default database or collection is not configured. values: database(%s); collection(%s)",
+				h.Options.Database,
+				h.Options.Collection,
+			)
+		}
+
+		return h.Options.Database, h.Options.Collection, nil
+	}
+
+	coll, ok := h.Options.Collections[name]
+	if !ok || coll == "" {
+		return "", "", fmt.Errorf("unknown logical collection %q: not found in collections", name)
+	}
+
+	db, ok := h.Options.Databases[name]
+	if !ok || db == "" {
+		db = h.Options.Database
+	}
+	if db == "" {
+		return "", "", fmt.Errorf(
+			"no database for logical collection %q: not found in databases and no default database",
+			name,
+		)
+	}
+
+	return db, coll, nil
+}
+
+func (h *Helper) Coll(name string) (CollClient, error) {
+	db, coll, err := h.Resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.NewCollCli(db, coll)
+}
+
+func (h *Helper) DB(name string) (DBClient, error) {
+	db, ok := h.Options.Databases[name]
+	if !ok || db == "" {
+		if name != "" {
+			return nil, fmt.Errorf("unknown logical database %q: not found in databases", name)
+		}
+
+		db = h.Options.Database
+	}
+
+	return h.NewDBCli(db)
+}
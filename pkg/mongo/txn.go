@@ -0,0 +1,174 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+const (
+	transientTxnErrLabel     = "TransientTransactionError"
+	unknownCommitResultLabel = "UnknownTransactionCommitResult"
+)
+
+type TxnRetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *TxnRetryError) Error() string {
+	return fmt.Sprintf("transaction retries exhausted after %d attempts: %s", e.Attempts, e.Err.Error())
+}
+
+func (e *TxnRetryError) Unwrap() error {
+	return e.Err
+}
+
+func hasErrorLabel(err error, label string) bool {
+	var le mongo.LabeledError
+	if errors.As(err, &le) {
+		return le.HasErrorLabel(label)
+	}
+
+	return false
+}
+
+func (h *Helper) txnOptions(opts []*options.TransactionOptions) *options.TransactionOptions {
+	txnOpts := options.Transaction()
+	if h.Txn.ReadConcern != "" {
+		txnOpts.SetReadConcern(&readconcern.ReadConcern{Level: h.Txn.ReadConcern})
+	}
+
+	if h.Txn.WriteConcern != "" {
+		var w interface{} = h.Txn.WriteConcern
+		n, err := strconv.Atoi(h.Txn.WriteConcern)
+		if err == nil {
+			w = n
+		}
+		txnOpts.SetWriteConcern(&writeconcern.WriteConcern{W: w})
+	}
+
+	return options.MergeTransactionOptions(append([]*options.TransactionOptions{txnOpts}, opts...)...)
+}
+
+func (h *Helper) nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if h.Txn.MaxBackoff > 0 && backoff > h.Txn.MaxBackoff.Std() {
+		return h.Txn.MaxBackoff.Std()
+	}
+
+	return backoff
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func toSession(t TxnClient) (mongo.Session, error) {
+	s, ok := t.(mongo.Session)
+	if !ok {
+		return nil, fmt.Errorf("txn client does not implement mongo.Session. values: type(%T)", t)
+	}
+
+	return s, nil
+}
+
+func (h *Helper) RunInTxn(ctx context.Context, fn func(ctx mongo.SessionContext) error, opts ...*options.TransactionOptions) error {
+	txnOpts := h.txnOptions(opts)
+	backoff := h.Txn.Backoff.Std()
+
+	var err error
+	attempts := 0
+	for attempts <= h.Txn.MaxRetries {
+		attempts++
+		err = h.runTxnOnce(ctx, fn, txnOpts)
+		if err == nil {
+			return nil
+		}
+
+		if !hasErrorLabel(err, transientTxnErrLabel) && !hasErrorLabel(err, unknownCommitResultLabel) {
+			return err
+		}
+
+		if attempts > h.Txn.MaxRetries || hasErrorLabel(err, unknownCommitResultLabel) {
+			break
+		}
+
+		err = sleepCtx(ctx, backoff)
+		if err != nil {
+			return err
+		}
+		backoff = h.nextBackoff(backoff)
+	}
+
+	return &TxnRetryError{Attempts: attempts, Err: err}
+}
+
+func (h *Helper) runTxnOnce(ctx context.Context, fn func(ctx mongo.SessionContext) error, txnOpts *options.TransactionOptions) error {
+	done := h.inflight.begin()
+	defer done()
+
+	sess, err := h.NewTxnCli()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(context.Background())
+
+	session, err := toSession(sess)
+	if err != nil {
+		return err
+	}
+
+	err = sess.StartTransaction(txnOpts)
+	if err != nil {
+		return err
+	}
+
+	sc := mongo.NewSessionContext(ctx, session)
+	err = fn(sc)
+	if err != nil {
+		abortErr := sess.AbortTransaction(context.Background())
+		if abortErr != nil {
+			return fmt.Errorf("%w; abort transaction: %s", err, abortErr.Error())
+		}
+
+		return err
+	}
+
+	return h.commitWithRetry(ctx, sess)
+}
+
+func (h *Helper) commitWithRetry(ctx context.Context, sess TxnClient) error {
+	backoff := h.Txn.Backoff.Std()
+	for retries := 0; ; retries++ {
+		err := sess.CommitTransaction(ctx)
+		if err == nil {
+			return nil
+		}
+
+		if !hasErrorLabel(err, unknownCommitResultLabel) || retries >= h.Txn.MaxRetries {
+			return err
+		}
+
+		err = sleepCtx(ctx, backoff)
+		if err != nil {
+			return err
+		}
+		backoff = h.nextBackoff(backoff)
+	}
+}
@@ -0,0 +1,95 @@
+package mongo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/mongo"
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/mongo/mongotest"
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestRunInTxn(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	tests := []struct {
+		name      string
+		faults    []mongotest.Fault
+		fnErr     error
+		wantCalls int
+		wantDocs  int
+		wantErr   func(error) bool
+	}{
+		{
+			name:      "commit",
+			wantCalls: 1,
+			wantDocs:  1,
+		},
+		{
+			name:      "function error aborts",
+			fnErr:     errBoom,
+			wantCalls: 1,
+			wantErr:   func(err error) bool { return errors.Is(err, errBoom) },
+		},
+		{
+			name:      "transient error retries",
+			faults:    []mongotest.Fault{{Op: "CommitTransaction", Err: mongotest.LabeledError("TransientTransactionError"), Times: 1}},
+			wantCalls: 2,
+			wantDocs:  1,
+		},
+		{
+			name:      "transient error exhausts retries",
+			faults:    []mongotest.Fault{{Op: "CommitTransaction", Err: mongotest.LabeledError("TransientTransactionError")}},
+			wantCalls: 3,
+			wantErr: func(err error) bool {
+				var re *mongo.TxnRetryError
+				return errors.As(err, &re) && re.Attempts == 3
+			},
+		},
+		{
+			name:      "unknown commit result retries the commit only",
+			faults:    []mongotest.Fault{{Op: "CommitTransaction", Err: mongotest.LabeledError("UnknownTransactionCommitResult"), Times: 1}},
+			wantCalls: 1,
+			wantDocs:  1,
+		},
+		{
+			name:      "other commit errors are not retried",
+			faults:    []mongotest.Fault{{Op: "CommitTransaction", Err: errBoom, Times: 1}},
+			wantCalls: 1,
+			wantErr:   func(err error) bool { return errors.Is(err, errBoom) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, f := newHelper(t, mongo.TxnMaxRetries(2), mongo.TxnBackoff(time.Millisecond))
+			f.Inject(tt.faults...)
+
+			calls := 0
+			err := h.RunInTxn(context.Background(), func(ctx driver.SessionContext) error {
+				calls++
+				err := h.InsertCtx(ctx, testDB, "orders", bson.M{"_id": "o1"})
+				if err != nil {
+					return err
+				}
+				return tt.fnErr
+			})
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if tt.wantErr != nil && !tt.wantErr(err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if calls != tt.wantCalls {
+				t.Errorf("expected %d calls, got %d", tt.wantCalls, calls)
+			}
+			if n := len(f.Docs(testDB, "orders")); n != tt.wantDocs {
+				t.Errorf("expected %d documents, got %d", tt.wantDocs, n)
+			}
+		})
+	}
+}
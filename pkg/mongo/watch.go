@@ -0,0 +1,471 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	log "go-micro.dev/v5/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ChangeInsert  ChangeOperation = "insert"
+	ChangeUpdate  ChangeOperation = "update"
+	ChangeReplace ChangeOperation = "replace"
+	ChangeDelete  ChangeOperation = "delete"
+
+	ChangeDrop         ChangeOperation = "drop"
+	ChangeRename       ChangeOperation = "rename"
+	ChangeDropDatabase ChangeOperation = "dropDatabase"
+	ChangeInvalidate   ChangeOperation = "invalidate"
+
+	changeStreamHistoryLostCode = 286
+	changeStreamFatalErrorCode  = 280
+)
+
+var (
+	ErrStreamInvalidated = errors.New("change stream invalidated")
+)
+
+type ChangeOperation string
+
+type ChangeNamespace struct {
+	DB   string `bson:"db"`
+	Coll string `bson:"coll"`
+}
+
+type UpdateDescription struct {
+	UpdatedFields bson.M   `bson:"updatedFields"`
+	RemovedFields []string `bson:"removedFields"`
+}
+
+type ChangeEvent struct {
+	Token             bson.Raw            `bson:"_id"`
+	OperationType     ChangeOperation     `bson:"operationType"`
+	Namespace         ChangeNamespace     `bson:"ns"`
+	DocumentKey       bson.Raw            `bson:"documentKey"`
+	FullDocument      bson.Raw            `bson:"fullDocument,omitempty"`
+	UpdateDescription *UpdateDescription  `bson:"updateDescription,omitempty"`
+	ClusterTime       primitive.Timestamp `bson:"clusterTime"`
+}
+
+type ChangeHandler func(context.Context, ChangeEvent) error
+
+type HandlerError struct {
+	Event ChangeEvent
+	Err   error
+}
+
+func (e *HandlerError) Error() string {
+	return fmt.Sprintf("change handler failed on %s event: %s", e.Event.OperationType, e.Err.Error())
+}
+
+func (e *HandlerError) Unwrap() error {
+	return e.Err
+}
+
+type DecodeError struct {
+	Token bson.Raw
+	Err   error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode change event: %s", e.Err.Error())
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+type changeStream interface {
+	Next(context.Context) bool
+	Decode(interface{}) error
+	ResumeToken() bson.Raw
+	Err() error
+	Close(context.Context) error
+}
+
+type resumeToken struct {
+	ID        string    `bson:"_id"`
+	Token     bson.Raw  `bson:"token"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+type watcher struct {
+	h        *Helper
+	name     string
+	tokenDB  string
+	pipeline interface{}
+	handler  ChangeHandler
+	token    bson.Raw
+}
+
+func (h *Helper) Watch(ctx context.Context, db, coll string, pipeline interface{}, handler ChangeHandler) error {
+	if handler == nil {
+		return fmt.Errorf("change handler is nil")
+	}
+
+	c, err := h.NewCollCli(db, coll)
+	if err != nil {
+		return err
+	}
+
+	w, err := h.newWatcher(ctx, db, coll, pipeline, handler)
+	if err != nil {
+		return err
+	}
+
+	backoff := h.Watcher.Backoff.Std()
+	for {
+		progressed, err := w.run(ctx, c)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err == nil {
+			return nil
+		}
+
+		if !isResumableWatchErr(err) {
+			return err
+		}
+
+		if progressed {
+			backoff = h.Watcher.Backoff.Std()
+		}
+
+		log.Warnf("change stream on %s interrupted, resuming in %s: %s", w.name, backoff, err.Error())
+		err = sleepCtx(ctx, backoff)
+		if err != nil {
+			return err
+		}
+
+		backoff *= 2
+		if h.Watcher.MaxBackoff > 0 && backoff > h.Watcher.MaxBackoff.Std() {
+			backoff = h.Watcher.MaxBackoff.Std()
+		}
+	}
+}
+
+func (h *Helper) newWatcher(ctx context.Context, db, coll string, pipeline interface{}, handler ChangeHandler) (*watcher, error) {
+	if pipeline == nil {
+		pipeline = mongo.Pipeline{}
+	}
+
+	w := &watcher{
+		h:        h,
+		name:     fmt.Sprintf("%s.%s", db, coll),
+		tokenDB:  h.Watcher.TokenDatabase,
+		pipeline: pipeline,
+		handler:  handler,
+	}
+	if w.tokenDB == "" {
+		w.tokenDB = db
+	}
+
+	token, err := w.loadToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	w.token = token
+
+	return w, nil
+}
+
+func isResumableWatchErr(err error) bool {
+	if err == nil || errors.Is(err, ErrStreamInvalidated) {
+		return false
+	}
+
+	var handlerErr *HandlerError
+	if errors.As(err, &handlerErr) {
+		return false
+	}
+
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) {
+		return false
+	}
+
+	var se mongo.ServerError
+	if errors.As(err, &se) {
+		return !se.HasErrorCode(changeStreamHistoryLostCode) && !se.HasErrorCode(changeStreamFatalErrorCode)
+	}
+
+	return true
+}
+
+func (w *watcher) tokenColl() (CollClient, error) {
+	return w.h.NewCollCli(w.tokenDB, w.h.Watcher.TokenCollection)
+}
+
+func (w *watcher) loadToken(ctx context.Context) (bson.Raw, error) {
+	c, err := w.tokenColl()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := w.h.withTimeout(ctx)
+	defer cancel()
+
+	token := resumeToken{}
+	err = c.FindOne(ctx, bson.M{"_id": w.name}).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return token.Token, nil
+}
+
+func (w *watcher) saveToken(token bson.Raw) error {
+	c, err := w.tokenColl()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := w.h.withTimeout(context.Background())
+	defer cancel()
+	_, err = c.UpdateOne(
+		ctx,
+		bson.M{"_id": w.name},
+		bson.M{"$set": bson.M{"token": token, "updatedAt": time.Now().UTC()}},
+		CreateRecordIfNotExist,
+	)
+	if err != nil {
+		return err
+	}
+
+	w.token = token
+	return nil
+}
+
+func (w *watcher) clearToken() error {
+	c, err := w.tokenColl()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := w.h.withTimeout(context.Background())
+	defer cancel()
+	_, err = c.DeleteOne(ctx, bson.M{"_id": w.name})
+	if err != nil {
+		return err
+	}
+
+	w.token = nil
+	return nil
+}
+
+func (w *watcher) run(ctx context.Context, c CollClient) (bool, error) {
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if w.token != nil {
+		opts.SetResumeAfter(w.token)
+	}
+
+	stream, err := c.Watch(ctx, w.pipeline, opts)
+	if err != nil {
+		return false, err
+	}
+	defer stream.Close(context.Background())
+
+	return w.consume(ctx, stream)
+}
+
+func (w *watcher) consume(ctx context.Context, stream changeStream) (bool, error) {
+	invalidated := false
+	d := newDispatcher(ctx, w)
+	for stream.Next(ctx) {
+		ev := ChangeEvent{}
+		err := stream.Decode(&ev)
+		if err != nil {
+			d.close()
+			return d.progressed, &DecodeError{Token: stream.ResumeToken(), Err: err}
+		}
+
+		if ev.OperationType == ChangeInvalidate {
+			invalidated = true
+			break
+		}
+
+		if !d.dispatch(ev) {
+			break
+		}
+	}
+
+	err := d.close()
+	if err != nil {
+		return d.progressed, err
+	}
+
+	if invalidated {
+		err = w.clearToken()
+		if err != nil {
+			return d.progressed, fmt.Errorf("failed to clear resume token of %s: %w", w.name, err)
+		}
+
+		return d.progressed, fmt.Errorf("%w: %s", ErrStreamInvalidated, w.name)
+	}
+
+	return d.progressed, stream.Err()
+}
+
+type dispatcher struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	w       *watcher
+	workers []chan dispatchItem
+	wg      sync.WaitGroup
+
+	mu         sync.Mutex
+	seq        uint64
+	persisted  uint64
+	done       map[uint64]bson.Raw
+	err        error
+	progressed bool
+
+	saveMu sync.Mutex
+	saved  uint64
+}
+
+type dispatchItem struct {
+	seq uint64
+	ev  ChangeEvent
+}
+
+func newDispatcher(ctx context.Context, w *watcher) *dispatcher {
+	concurrency := w.h.Watcher.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	d := &dispatcher{
+		ctx:     ctx,
+		cancel:  cancel,
+		w:       w,
+		workers: make([]chan dispatchItem, concurrency),
+		done:    map[uint64]bson.Raw{},
+	}
+
+	for i := range d.workers {
+		d.workers[i] = make(chan dispatchItem)
+		d.wg.Add(1)
+		go d.work(d.workers[i])
+	}
+
+	return d
+}
+
+func (d *dispatcher) dispatch(ev ChangeEvent) bool {
+	d.mu.Lock()
+	if d.err != nil {
+		d.mu.Unlock()
+		return false
+	}
+	d.seq++
+	item := dispatchItem{seq: d.seq, ev: ev}
+	d.mu.Unlock()
+
+	hash := fnv.New32a()
+	hash.Write(ev.DocumentKey)
+	worker := d.workers[hash.Sum32()%uint32(len(d.workers))]
+
+	select {
+	case worker <- item:
+		return true
+	case <-d.ctx.Done():
+		return false
+	}
+}
+
+func (d *dispatcher) work(items chan dispatchItem) {
+	defer d.wg.Done()
+	for item := range items {
+		err := d.w.handler(d.ctx, item.ev)
+		if err != nil {
+			d.fail(&HandlerError{Event: item.ev, Err: err})
+			continue
+		}
+
+		d.complete(item)
+	}
+}
+
+func (d *dispatcher) fail(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err == nil {
+		d.err = err
+		d.cancel()
+	}
+}
+
+func (d *dispatcher) complete(item dispatchItem) {
+	d.mu.Lock()
+	if d.err != nil {
+		d.mu.Unlock()
+		return
+	}
+
+	d.done[item.seq] = item.ev.Token
+	var token bson.Raw
+	for {
+		t, ok := d.done[d.persisted+1]
+		if !ok {
+			break
+		}
+
+		delete(d.done, d.persisted+1)
+		d.persisted++
+		token = t
+	}
+	seq := d.persisted
+	d.mu.Unlock()
+
+	if token == nil {
+		return
+	}
+
+	d.saveMu.Lock()
+	defer d.saveMu.Unlock()
+	if seq <= d.saved {
+		return
+	}
+
+	err := d.w.saveToken(token)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err != nil {
+		if d.err == nil {
+			d.err = fmt.Errorf("failed to persist resume token of %s: %w", d.w.name, err)
+			d.cancel()
+		}
+		return
+	}
+
+	d.saved = seq
+	d.progressed = true
+}
+
+func (d *dispatcher) close() error {
+	for _, worker := range d.workers {
+		close(worker)
+	}
+	d.wg.Wait()
+	d.cancel()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
@@ -0,0 +1,221 @@
+package mongo_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/mongo"
+	"github.com/bigstack-oss/bigstack-dependency-go/pkg/mongo/mongotest"
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	tokenColl = "_resumeTokens"
+)
+
+type eventStream struct {
+	events []bson.M
+	pos    int
+	err    error
+}
+
+func (s *eventStream) Next(context.Context) bool {
+	if s.pos >= len(s.events) {
+		return false
+	}
+
+	s.pos++
+	return true
+}
+
+func (s *eventStream) Decode(v interface{}) error {
+	b, err := bson.Marshal(s.events[s.pos-1])
+	if err != nil {
+		return err
+	}
+
+	return bson.Unmarshal(b, v)
+}
+
+func (s *eventStream) ResumeToken() bson.Raw {
+	b, _ := bson.Marshal(s.events[s.pos-1]["_id"])
+	return b
+}
+
+func (s *eventStream) Err() error {
+	return s.err
+}
+
+func (s *eventStream) Close(context.Context) error {
+	return nil
+}
+
+func event(id string, op mongo.ChangeOperation) bson.M {
+	return bson.M{
+		"_id":           bson.M{"_data": "token-" + id},
+		"operationType": string(op),
+		"ns":            bson.M{"db": testDB, "coll": "users"},
+		"documentKey":   bson.M{"_id": id},
+	}
+}
+
+func storedToken(t *testing.T, f *mongotest.Fake) string {
+	t.Helper()
+
+	docs := f.Docs(testDB, tokenColl)
+	if len(docs) == 0 {
+		return ""
+	}
+
+	token, _ := docs[0]["token"].(bson.M)
+	data, _ := token["_data"].(string)
+	return data
+}
+
+func worker(id string, workers uint32) uint32 {
+	key, _ := bson.Marshal(bson.M{"_id": id})
+	hash := fnv.New32a()
+	hash.Write(key)
+	return hash.Sum32() % workers
+}
+
+func TestConsumeChangeStream(t *testing.T) {
+	handlerErr := errors.New("handler failed")
+
+	tests := []struct {
+		name      string
+		events    []bson.M
+		streamErr error
+		handler   mongo.ChangeHandler
+		wantErr   func(error) bool
+		wantToken string
+	}{
+		{
+			name:      "saves the last token",
+			events:    []bson.M{event("a", mongo.ChangeInsert), event("b", mongo.ChangeUpdate), event("c", mongo.ChangeDelete)},
+			wantToken: "token-c",
+		},
+		{
+			name:   "invalidate clears the token",
+			events: []bson.M{event("a", mongo.ChangeInsert), event("b", mongo.ChangeInvalidate)},
+			wantErr: func(err error) bool {
+				return errors.Is(err, mongo.ErrStreamInvalidated) && !mongo.IsResumableWatchErr(err)
+			},
+		},
+		{
+			name:   "handler error keeps the last handled token",
+			events: []bson.M{event("a", mongo.ChangeInsert), event("b", mongo.ChangeInsert), event("c", mongo.ChangeInsert)},
+			handler: func(_ context.Context, ev mongo.ChangeEvent) error {
+				if ev.DocumentKey.Lookup("_id").StringValue() == "b" {
+					return handlerErr
+				}
+				return nil
+			},
+			wantErr: func(err error) bool {
+				var he *mongo.HandlerError
+				return errors.As(err, &he) && errors.Is(err, handlerErr) && !mongo.IsResumableWatchErr(err)
+			},
+			wantToken: "token-a",
+		},
+		{
+			name:   "decode error is not resumable",
+			events: []bson.M{event("a", mongo.ChangeInsert), {"_id": bson.M{"_data": "token-b"}, "operationType": 42}},
+			wantErr: func(err error) bool {
+				var de *mongo.DecodeError
+				return errors.As(err, &de) && !mongo.IsResumableWatchErr(err)
+			},
+			wantToken: "token-a",
+		},
+		{
+			name:      "stream error is resumable",
+			events:    []bson.M{event("a", mongo.ChangeInsert)},
+			streamErr: driver.ErrClientDisconnected,
+			wantErr:   mongo.IsResumableWatchErr,
+			wantToken: "token-a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, f := newHelper(t)
+			handler := tt.handler
+			if handler == nil {
+				handler = func(context.Context, mongo.ChangeEvent) error { return nil }
+			}
+
+			stream := &eventStream{events: tt.events, err: tt.streamErr}
+			_, err := mongo.ConsumeChangeStream(context.Background(), h, testDB, "users", stream, handler)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if tt.wantErr != nil && !tt.wantErr(err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := storedToken(t, f); got != tt.wantToken {
+				t.Errorf("expected token %q, got %q", tt.wantToken, got)
+			}
+		})
+	}
+}
+
+func TestConsumeChangeStreamTokenOrder(t *testing.T) {
+	h, f := newHelper(t, mongo.WatcherConcurrency(2))
+
+	slow, fast := "", ""
+	for i := 0; slow == "" || fast == ""; i++ {
+		id := fmt.Sprintf("doc-%d", i)
+		if worker(id, 2) == 0 && slow == "" {
+			slow = id
+		} else if worker(id, 2) == 1 && fast == "" {
+			fast = id
+		}
+	}
+
+	release := make(chan struct{})
+	fastDone := make(chan struct{})
+	var once sync.Once
+	handler := func(_ context.Context, ev mongo.ChangeEvent) error {
+		switch ev.DocumentKey.Lookup("_id").StringValue() {
+		case slow:
+			<-release
+		case fast:
+			once.Do(func() { close(fastDone) })
+		}
+		return nil
+	}
+
+	done := make(chan error, 1)
+	stream := &eventStream{events: []bson.M{event(slow, mongo.ChangeInsert), event(fast, mongo.ChangeInsert)}}
+	go func() {
+		_, err := mongo.ConsumeChangeStream(context.Background(), h, testDB, "users", stream, handler)
+		done <- err
+	}()
+
+	select {
+	case <-fastDone:
+	case <-time.After(time.Second):
+		t.Fatalf("fast handler did not run")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if got := storedToken(t, f); got != "" {
+		t.Fatalf("token advanced past an unfinished event: %q", got)
+	}
+
+	close(release)
+	err := <-done
+	if err != nil {
+		t.Fatalf("consume failed: %s", err.Error())
+	}
+
+	if got, want := storedToken(t, f), "token-"+fast; got != want {
+		t.Errorf("expected token %q, got %q", want, got)
+	}
+}